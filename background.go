@@ -0,0 +1,225 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// colorBins is the number of bins per channel in the color histograms used by SegmentPerson
+const colorBins = 16
+
+// colorModel is a smoothed color histogram
+type colorModel [colorBins * colorBins * colorBins]float64
+
+func colorBin(r, g, b uint8) int {
+	const shift = 4 // 256 / colorBins == 1<<4
+	return int(r>>shift)*colorBins*colorBins + int(g>>shift)*colorBins + int(b>>shift)
+}
+
+// add adds the opaque pixels of img inside rect to the model
+func (m *colorModel) add(img *image.NRGBA, rect image.Rectangle) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			if img.Pix[i+3] == 0 {
+				continue
+			}
+			m[colorBin(img.Pix[i], img.Pix[i+1], img.Pix[i+2])]++
+		}
+	}
+}
+
+// normalize smooths the model over neighboring bins so similar colors share probability, and scales it to sum to 1
+func (m *colorModel) normalize() {
+	smoothed := new(colorModel)
+	total := 0.0
+	for r := 0; r < colorBins; r++ {
+		for g := 0; g < colorBins; g++ {
+			for b := 0; b < colorBins; b++ {
+				sum := 0.0
+				for dr := -1; dr <= 1; dr++ {
+					for dg := -1; dg <= 1; dg++ {
+						for db := -1; db <= 1; db++ {
+							rr, gg, bb := r+dr, g+dg, b+db
+							if rr < 0 || gg < 0 || bb < 0 || rr >= colorBins || gg >= colorBins || bb >= colorBins {
+								continue
+							}
+							sum += m[rr*colorBins*colorBins+gg*colorBins+bb]
+						}
+					}
+				}
+				smoothed[r*colorBins*colorBins+g*colorBins+b] = sum
+				total += sum
+			}
+		}
+	}
+	if total == 0 {
+		total = 1
+	}
+	for i := range smoothed {
+		m[i] = smoothed[i] / total
+	}
+}
+
+// SegmentPerson estimates the region of img containing the person whose face was detected,
+// returning a matte where 255 is the person and 0 is the background.
+// Color models for the background and person are built from the image edges and from the face and torso,
+// then the person region is grown outward from the face through pixels that better match the person model,
+// weighted towards a head and shoulders template around the face.
+// Enclosed background regions are filled in as part of the person
+func SegmentPerson(img *image.NRGBA, face *Face) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	matte := image.NewGray(b)
+	if w == 0 || h == 0 {
+		return matte
+	}
+
+	s := face.Bounds.Scale
+	faceRect := image.Rect(face.Bounds.Col-s*4/10, face.Bounds.Row-s*4/10, face.Bounds.Col+s*4/10, face.Bounds.Row+s*4/10)
+	chin := face.Bounds.Row + s/2
+	torsoRect := image.Rect(face.Bounds.Col-s/2, chin+s/4, face.Bounds.Col+s/2, b.Max.Y)
+
+	// sample the background from the top and the sides of the image down to the chin
+	band := maxInt(2, minInt(w, h)*3/100)
+	bg := new(colorModel)
+	bg.add(img, image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+band))
+	bg.add(img, image.Rect(b.Min.X, b.Min.Y+band, b.Min.X+band, chin))
+	bg.add(img, image.Rect(b.Max.X-band, b.Min.Y+band, b.Max.X, chin))
+	bg.normalize()
+
+	fg := new(colorModel)
+	fg.add(img, faceRect)
+	fg.add(img, torsoRect)
+	fg.normalize()
+
+	// prior weights the person model by how likely a person is at x, y,
+	// using a template of a head and shoulders around the face
+	prior := func(x, y int) float64 {
+		dx := float64(x - face.Bounds.Col)
+		if y <= chin {
+			dy := float64(y-face.Bounds.Row) + 0.1*float64(s)
+			rx, ry := 0.65*float64(s), 0.8*float64(s)
+			if (dx*dx)/(rx*rx)+(dy*dy)/(ry*ry) <= 1 {
+				return 4
+			}
+			return 0.25
+		}
+		halfWidth := 0.35*float64(s) + 1.2*float64(y-chin)
+		if halfWidth > 1.6*float64(s) {
+			halfWidth = 1.6 * float64(s)
+		}
+		if dx >= -halfWidth && dx <= halfWidth {
+			return 4
+		}
+		return 0.25
+	}
+
+	// isPerson reports whether the pixel at x, y matches the weighted person model at least as well as the background model.
+	// Colors seen in neither model, such as hair, are treated as part of the person
+	isPerson := func(x, y int) bool {
+		i := img.PixOffset(x, y)
+		if img.Pix[i+3] == 0 {
+			return false
+		}
+		bin := colorBin(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+		return (fg[bin]+1e-6)*prior(x, y) >= bg[bin]
+	}
+
+	const (
+		unvisited = iota
+		person
+		background
+	)
+	state := make([]uint8, w*h)
+	queue := make([]image.Point, 0, w*h/4)
+
+	// grow the person region from the face and torso
+	for _, seed := range []image.Rectangle{faceRect.Intersect(b), torsoRect.Intersect(b)} {
+		for y := seed.Min.Y; y < seed.Max.Y; y++ {
+			for x := seed.Min.X; x < seed.Max.X; x++ {
+				if idx := (y-b.Min.Y)*w + (x - b.Min.X); state[idx] == unvisited && isPerson(x, y) {
+					state[idx] = person
+					queue = append(queue, image.Pt(x, y))
+				}
+			}
+		}
+	}
+	neighbors := []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	for len(queue) > 0 {
+		p := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, d := range neighbors {
+			n := p.Add(d)
+			if !n.In(b) {
+				continue
+			}
+			if idx := (n.Y-b.Min.Y)*w + (n.X - b.Min.X); state[idx] == unvisited && isPerson(n.X, n.Y) {
+				state[idx] = person
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	// flood the background from the top and sides of the image so enclosed holes are left as part of the person
+	for x := b.Min.X; x < b.Max.X; x++ {
+		queue = append(queue, image.Pt(x, b.Min.Y))
+	}
+	for y := b.Min.Y; y < chin && y < b.Max.Y; y++ {
+		queue = append(queue, image.Pt(b.Min.X, y), image.Pt(b.Max.X-1, y))
+	}
+	for len(queue) > 0 {
+		p := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		idx := (p.Y-b.Min.Y)*w + (p.X - b.Min.X)
+		if state[idx] != unvisited {
+			continue
+		}
+		state[idx] = background
+		for _, d := range neighbors {
+			if n := p.Add(d); n.In(b) {
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	for idx, st := range state {
+		if st != background {
+			matte.Pix[(idx/w)*matte.Stride+idx%w] = 255
+		}
+	}
+
+	return matte
+}
+
+// ReplaceBackground composites img over a solid background color using matte, as returned by SegmentPerson.
+// The edge of the matte is feathered with a gaussian blur with a sigma of feather pixels
+func ReplaceBackground(img image.Image, matte *image.Gray, background color.NRGBA, feather float64) *image.NRGBA {
+	dst := imaging.Clone(img)
+
+	alpha := imaging.Clone(matte)
+	if feather > 0 {
+		alpha = imaging.Blur(alpha, feather)
+	}
+
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	if ab := alpha.Bounds(); ab.Dx() < w || ab.Dy() < h {
+		w, h = minInt(w, ab.Dx()), minInt(h, ab.Dy())
+	}
+
+	bg := [4]float64{float64(background.R), float64(background.G), float64(background.B), float64(background.A)}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := float64(alpha.Pix[y*alpha.Stride+x*4]) / 255
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = clampUint8(float64(dst.Pix[i+c])*a + bg[c]*(1-a))
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,104 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// personImage returns a blue image with a skin colored face centered at 60, 60 and a red shirt below it,
+// with a blue patch enclosed by the shirt
+func personImage() (*image.NRGBA, *Face) {
+	var (
+		blue  = color.NRGBA{0x20, 0x40, 0xe0, 0xff}
+		skin  = color.NRGBA{0xe0, 0xb0, 0x90, 0xff}
+		shirt = color.NRGBA{0xc0, 0x20, 0x20, 0xff}
+	)
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 160))
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 120; x++ {
+			dx, dy := float64(x-60)/20, float64(y-60)/26
+			switch {
+			case dx*dx+dy*dy <= 1:
+				img.SetNRGBA(x, y, skin)
+			case y >= 110 && x >= 30 && x < 90 && !(y >= 130 && y < 135 && x >= 55 && x < 65):
+				img.SetNRGBA(x, y, shirt)
+			default:
+				img.SetNRGBA(x, y, blue)
+			}
+		}
+	}
+	return img, &Face{Bounds: pigo.Detection{Row: 60, Col: 60, Scale: 40}}
+}
+
+func TestSegmentPerson(t *testing.T) {
+	img, face := personImage()
+	matte := SegmentPerson(img, face)
+	if matte.Bounds() != img.Bounds() {
+		t.Fatalf("matte bounds = %v, want %v", matte.Bounds(), img.Bounds())
+	}
+
+	for _, test := range []struct {
+		name string
+		p    image.Point
+		want uint8
+	}{
+		{"face", image.Pt(60, 60), 255},
+		{"shirt", image.Pt(40, 150), 255},
+		{"enclosed patch", image.Pt(60, 132), 255},
+		{"top corner", image.Pt(2, 2), 0},
+		{"beside head", image.Pt(100, 60), 0},
+		{"beside shirt", image.Pt(5, 150), 0},
+	} {
+		if got := matte.GrayAt(test.p.X, test.p.Y).Y; got != test.want {
+			t.Errorf("%s at %v = %d, want %d", test.name, test.p, got, test.want)
+		}
+	}
+
+	if empty := SegmentPerson(image.NewNRGBA(image.Rect(0, 0, 0, 0)), face); !empty.Bounds().Empty() {
+		t.Errorf("empty image matte bounds = %v", empty.Bounds())
+	}
+}
+
+func TestReplaceBackground(t *testing.T) {
+	fg := color.NRGBA{0x10, 0x20, 0x30, 0xff}
+	bg := color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:i+4], []uint8{fg.R, fg.G, fg.B, fg.A})
+	}
+	// the person is the left half of the image
+	matte := image.NewGray(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			matte.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	replaced := ReplaceBackground(img, matte, bg, 0)
+	if c := replaced.NRGBAAt(2, 5); c != fg {
+		t.Errorf("person pixel = %v, want %v", c, fg)
+	}
+	if c := replaced.NRGBAAt(17, 5); c != bg {
+		t.Errorf("background pixel = %v, want %v", c, bg)
+	}
+	if c := img.NRGBAAt(17, 5); c != fg {
+		t.Errorf("source pixel = %v, want it unmodified", c)
+	}
+
+	feathered := ReplaceBackground(img, matte, bg, 2)
+	if c := feathered.NRGBAAt(10, 5); c.R <= fg.R || c.R >= bg.R {
+		t.Errorf("feathered edge pixel = %v, want a blend of %v and %v", c, fg, bg)
+	}
+	if c := feathered.NRGBAAt(0, 5); c != fg {
+		t.Errorf("feathered person pixel = %v, want %v", c, fg)
+	}
+
+	// pixels outside of a smaller matte are left as they are
+	small := image.NewGray(image.Rect(0, 0, 10, 10))
+	if c := ReplaceBackground(img, small, bg, 0).NRGBAAt(17, 5); c != fg {
+		t.Errorf("pixel outside matte = %v, want %v", c, fg)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	convert "github.com/korylprince/go-face-detect/converter"
+)
+
+// parseHexColor parses a color in the form #rgb, #rrggbb, or #rrggbbaa
+func parseHexColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid length: %d", len(s))
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid hex: %w", err)
+	}
+
+	return color.NRGBA{b[0], b[1], b[2], b[3]}, nil
+}
+
+// parseWeights parses three comma separated floats
+func parseWeights(s string) ([3]float64, error) {
+	var weights [3]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return weights, fmt.Errorf("expected 3 weights, got %d", len(parts))
+	}
+
+	for i, p := range parts {
+		w, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return weights, fmt.Errorf("invalid weight %q: %w", p, err)
+		}
+		weights[i] = w
+	}
+
+	return weights, nil
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePNGCompression parses a png.CompressionLevel name
+func parsePNGCompression(s string) (png.CompressionLevel, error) {
+	switch s {
+	case "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "fast":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+	return png.DefaultCompression, fmt.Errorf("unknown compression level")
+}
+
+// parseRosterColumns parses a comma separated list of field=column mappings (e.g. id=EmployeeID,path=Photo),
+// using convert.DefaultRosterColumns for fields that aren't given
+func parseRosterColumns(s string) (convert.RosterColumns, error) {
+	columns := convert.DefaultRosterColumns
+	for _, item := range splitList(s) {
+		field, column, ok := strings.Cut(item, "=")
+		if !ok {
+			return columns, fmt.Errorf("invalid mapping %q: expected field=column", item)
+		}
+		switch strings.TrimSpace(field) {
+		case "id":
+			columns.ID = strings.TrimSpace(column)
+		case "name":
+			columns.Name = strings.TrimSpace(column)
+		case "path":
+			columns.Path = strings.TrimSpace(column)
+		default:
+			return columns, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return columns, nil
+}
+
+// parseRetries parses a comma separated list of retry strategies, where all expands to convert.DefaultRetryStrategies.
+// Strategies after their first occurrence are ignored
+func parseRetries(s string) ([]convert.RetryStrategy, error) {
+	var retries []convert.RetryStrategy
+	seen := make(map[convert.RetryStrategy]bool)
+	for _, item := range splitList(s) {
+		strategies := []convert.RetryStrategy{convert.RetryStrategy(item)}
+		if item == "all" {
+			strategies = convert.DefaultRetryStrategies
+		}
+		for _, strategy := range strategies {
+			if !seen[strategy] {
+				seen[strategy] = true
+				retries = append(retries, strategy)
+			}
+		}
+	}
+	return retries, convert.ValidateRetryStrategies(retries)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	convert "github.com/korylprince/go-face-detect/converter"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  color.NRGBA
+		valid bool
+	}{
+		{"#ffffff", color.NRGBA{0xff, 0xff, 0xff, 0xff}, true},
+		{"#1a2B3c", color.NRGBA{0x1a, 0x2b, 0x3c, 0xff}, true},
+		{"1a2b3c", color.NRGBA{0x1a, 0x2b, 0x3c, 0xff}, true},
+		{"#abc", color.NRGBA{0xaa, 0xbb, 0xcc, 0xff}, true},
+		{"#1a2b3c80", color.NRGBA{0x1a, 0x2b, 0x3c, 0x80}, true},
+		{"", color.NRGBA{}, false},
+		{"#abcd", color.NRGBA{}, false},
+		{"#gggggg", color.NRGBA{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseHexColor(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("parseHexColor(%q) error = %v, want valid %t", test.s, err, test.valid)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseHexColor(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  [3]float64
+		valid bool
+	}{
+		{"0.299,0.587,0.114", [3]float64{0.299, 0.587, 0.114}, true},
+		{" 1 , 0 ,0 ", [3]float64{1, 0, 0}, true},
+		{"1,2", [3]float64{}, false},
+		{"1,2,3,4", [3]float64{}, false},
+		{"1,x,3", [3]float64{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseWeights(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("parseWeights(%q) error = %v, want valid %t", test.s, err, test.valid)
+			continue
+		}
+		if test.valid && got != test.want {
+			t.Errorf("parseWeights(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{" a, b ,,c ,", []string{"a", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		if got := splitList(test.s); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitList(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestParsePNGCompression(t *testing.T) {
+	for s, want := range map[string]png.CompressionLevel{
+		"default": png.DefaultCompression,
+		"none":    png.NoCompression,
+		"fast":    png.BestSpeed,
+		"best":    png.BestCompression,
+	} {
+		if got, err := parsePNGCompression(s); err != nil || got != want {
+			t.Errorf("parsePNGCompression(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := parsePNGCompression("max"); err == nil {
+		t.Error("parsePNGCompression(max): expected error")
+	}
+}
+
+func TestParseRosterColumns(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  convert.RosterColumns
+		valid bool
+	}{
+		{"", convert.DefaultRosterColumns, true},
+		{"id=EmployeeID, path = Photo", convert.RosterColumns{ID: "EmployeeID", Name: "name", Path: "Photo"}, true},
+		{"name=", convert.RosterColumns{ID: "id", Path: "path"}, true},
+		{"id", convert.RosterColumns{}, false},
+		{"email=Email", convert.RosterColumns{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseRosterColumns(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("parseRosterColumns(%q) error = %v, want valid %t", test.s, err, test.valid)
+			continue
+		}
+		if test.valid && got != test.want {
+			t.Errorf("parseRosterColumns(%q) = %+v, want %+v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestParseRetries(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  []convert.RetryStrategy
+		valid bool
+	}{
+		{"", nil, true},
+		{"rotate, orient", []convert.RetryStrategy{convert.RetryRotate, convert.RetryOrient}, true},
+		{"all", convert.DefaultRetryStrategies, true},
+		{"relaxed,all", []convert.RetryStrategy{convert.RetryRelaxed, convert.RetryOrient, convert.RetryEqualize, convert.RetryRotate, convert.RetryUpscale}, true},
+		{"all,rotate", convert.DefaultRetryStrategies, true},
+		{"rotate,rotate", []convert.RetryStrategy{convert.RetryRotate}, true},
+		{"rotate,spin", nil, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseRetries(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("parseRetries(%q) error = %v, want valid %t", test.s, err, test.valid)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseRetries(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
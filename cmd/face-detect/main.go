@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"syscall"
 
 	facedetect "github.com/korylprince/go-face-detect"
 	"github.com/korylprince/go-face-detect/cascade"
@@ -16,29 +20,78 @@ import (
 )
 
 var Usage = func() {
-	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] -out <output directory> <input file>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] -out <output directory> <input file or directory>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] -out <output directory> -roster <roster CSV>\n", filepath.Base(os.Args[0]))
 	flag.PrintDefaults()
 	fmt.Fprintf(flag.CommandLine.Output(), "\n%s detects a single face in an image, automatically rotates, crops, brightens the image and writes it to a new file.\n", filepath.Base(os.Args[0]))
 	fmt.Fprintf(flag.CommandLine.Output(), "If multiple input images are given, they'll be processed in parallel.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Input directories are searched recursively for images matching -include and not matching -exclude.\n")
 }
 
 func main() {
-	flWorkers := flag.Int("workers", runtime.NumCPU(), "number of concurrent workers to use")
-	flOverwrite := flag.Bool("overwrite", false, "overwrite existing files")
+	flWorkers := flag.Int("workers", runtime.NumCPU(), "number of concurrent detection workers to use")
+	flDecodeWorkers := flag.Int("decode-workers", 0, "number of concurrent workers decoding inputs (default -workers)")
+	flEncodeWorkers := flag.Int("encode-workers", 0, "number of concurrent workers encoding outputs (default -workers)")
+	flMemoryBudget := flag.Int64("memory-budget", 0, "the approximate memory in MiB used by images being converted. Fewer large images are converted at once (0 disables)")
+	flQueueSize := flag.Int("queue-size", 0, "number of images queued between the decode, detect, and encode stages (default -workers)")
+	flDryRun := flag.Bool("dry-run", false, "detect faces and report the predicted portraits without writing anything (reported to stderr if -result-log is -)")
+	flOverwrite := flag.Bool("overwrite", false, "overwrite existing files, reprocessing unchanged inputs with -manifest")
+	flManifest := flag.Bool("manifest", false, "keep a manifest in the output directory and only reprocess inputs whose content or settings changed")
+	flPrune := flag.Bool("prune", false, "remove outputs in the manifest whose inputs no longer exist (requires -manifest)")
+	flRetry := flag.String("retry", "", "comma separated strategies tried in order when detection fails: orient, equalize, rotate, upscale, relaxed, or all for every strategy not already listed")
+	flSidecars := flag.Bool("sidecars", true, "apply manual corrections from sidecar files next to inputs (e.g. photo.jpg.json)")
 	flUseEXIF := flag.Bool("use-exif", true, "automatically rotate photos based on EXIF orientation")
+	flFailPolicy := flag.String("fail-policy", "any", "when to exit non-zero: any (any input fails), threshold (the percentage of failed inputs exceeds -fail-threshold), fail-fast (stop on the first failure), or none")
+	flFailThreshold := flag.Float64("fail-threshold", 10, "the percentage of failed inputs allowed by the threshold -fail-policy")
+	flProgress := flag.String("progress", "auto", "show a progress line: auto (when stderr is a terminal), always, or never")
 	flLogLevel := flag.String("level", "INFO", "logging level parsable by slog.UnmarshalText")
+	flBaseDir := flag.String("base", "", "preserve the directory structure of inputs relative to this directory in the output directory")
+	flInclude := flag.String("include", "", "comma separated globs of files to include when searching input directories (default all files)")
+	flExclude := flag.String("exclude", "", "comma separated globs of files to exclude when searching input directories")
+	flRoster := flag.String("roster", "", "convert the photos listed in this CSV instead of input arguments. The name template can use {id} and {name}")
+	flRosterColumns := flag.String("roster-columns", "", "comma separated field=column mappings for the roster CSV columns (default id=id,name=name,path=path)")
+	flRosterStatus := flag.String("roster-status", "", "write the roster with the status of each row appended to this CSV (requires -roster)")
+	flResultLog := flag.String("result-log", "", "write a JSON object describing each input's result to this file, one per line (- for stdout)")
+	flQuarantine := flag.String("quarantine", "", "copy failed inputs to this directory with a JSON report and an annotated debug image")
+	flCollision := flag.String("collision", "error", "what to do when multiple inputs have the same output path: error or rename")
+	flFormat := flag.String("format", "", "the output format (jpeg, png, gif, bmp, tiff). The output extension is changed to match (default the input format)")
+	flJPEGQuality := flag.Int("jpeg-quality", 95, "the JPEG quality (1 to 100)")
+	flPNGCompression := flag.String("png-compression", "default", "the PNG compression level (default, none, fast, best)")
+	flMaxFileSize := flag.Int64("max-file-size", 0, "the maximum output size in bytes. Searches for the highest JPEG quality that fits, writing JPEG unless -format is given (0 disables)")
+	flMinJPEGQuality := flag.Int("min-jpeg-quality", 50, "the lowest JPEG quality tried when fitting -max-file-size")
+	flAllowDownscale := flag.Bool("allow-downscale", false, "downscale portraits that don't fit -max-file-size at -min-jpeg-quality")
+	flNameTemplate := flag.String("name-template", convert.DefaultNameTemplate, "the template used to name converted portraits. Placeholders: {base}, {ext}, {width}, {height}, {preset}, {hash}, {index}")
+	flPreset := flag.String("preset", "default", "the name of the portrait settings, used by the {preset} name template placeholder")
 	flOutPath := flag.String("out", "", "the directory where converted portraits will be written")
 	flAspectRatio := flag.Float64("aspect-ratio", 3.0/4.0, "the width / height aspect ratio for the converted portraits")
 	flMaxWidthRatio := flag.Float64("max-width-ratio", 1.5, "the max portrait width / detected face width ratio")
+	flHeadroom := flag.Float64("headroom", 0, "the space above the estimated top of the head as a ratio of the portrait height (0 frames from the eyes instead)")
 	flBrightness := flag.Float64("brightness", 0, "the percentage to adjust the converted portrait brightness (-100 to 100)")
 	flContrast := flag.Float64("contrast", 5, "the percentage to adjust the converted portrait contrast (-100 to 100)")
 	flGamma := flag.Float64("gamma", 1.4, "the amount to adjust the converted portrait gamma (1.0 returns the gamma as-is)")
+	flDenoise := flag.Int("denoise", 0, "the radius in pixels of the median filter used to denoise the converted portrait (0 disables)")
+	flSharpen := flag.Float64("sharpen", 0, "the amount of unsharp mask sharpening applied to the converted portrait (0 disables)")
+	flSharpenSigma := flag.Float64("sharpen-sigma", facedetect.DefaultSharpenSigma, "the sigma in pixels of the unsharp mask blur")
+	flStyle := flag.String("style", "", "the color style applied to the converted portrait (grayscale, sepia, duotone)")
+	flGrayWeights := flag.String("gray-weights", "0.299,0.587,0.114", "the comma separated red, green, and blue channel weights used by the grayscale and duotone styles")
+	flDuotoneShadow := flag.String("duotone-shadow", "#000000", "the hex color of shadows for the duotone style")
+	flDuotoneHighlight := flag.String("duotone-highlight", "#ffffff", "the hex color of highlights for the duotone style")
+	flBackground := flag.String("background", "", "the hex color to replace the background behind the person with (empty keeps the original background)")
+	flBackgroundFeather := flag.Float64("background-feather", 0.02, "the blur applied to the edge of the replaced background as a ratio of the detected face width")
+	flMask := flag.String("mask", "", "the shape of the transparent mask applied to the converted portrait (circle, rounded, ellipse). Masked portraits are written as PNG")
+	flMaskRadius := flag.Float64("mask-radius", 0.1, "the corner radius of the rounded mask as a ratio of the portrait's shortest side (0 to 0.5)")
 
 	flag.Usage = Usage
 	flag.Parse()
 	infiles := flag.Args()
 
-	if len(infiles) == 0 {
+	if (len(infiles) == 0) == (*flRoster == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *flRosterStatus != "" && *flRoster == "" {
+		fmt.Println("-roster-status requires -roster")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -49,12 +102,117 @@ func main() {
 		os.Exit(1)
 	}
 
+	switch convert.CollisionPolicy(*flCollision) {
+	case convert.CollisionError, convert.CollisionRename:
+	default:
+		fmt.Printf("unknown -collision (%s)\n", *flCollision)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var (
+		roster *convert.Roster
+		err    error
+	)
+
+	retries, err := parseRetries(*flRetry)
+	if err != nil {
+		fmt.Printf("invalid -retry (%s): %v\n", *flRetry, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	portraitConfig := &facedetect.PortraitConfig{
-		AspectRatio:   *flAspectRatio,
-		MaxWidthRatio: *flMaxWidthRatio,
-		Brightness:    *flBrightness,
-		Contrast:      *flContrast,
-		Gamma:         *flGamma,
+		Name:              *flPreset,
+		AspectRatio:       *flAspectRatio,
+		MaxWidthRatio:     *flMaxWidthRatio,
+		Headroom:          *flHeadroom,
+		Brightness:        *flBrightness,
+		Contrast:          *flContrast,
+		Gamma:             *flGamma,
+		Denoise:           *flDenoise,
+		Sharpen:           *flSharpen,
+		SharpenSigma:      *flSharpenSigma,
+		Style:             facedetect.Style(*flStyle),
+		BackgroundFeather: *flBackgroundFeather,
+		Mask:              facedetect.Mask(*flMask),
+		MaskRadius:        *flMaskRadius,
+		Format:            facedetect.Format(*flFormat),
+		JPEGQuality:       *flJPEGQuality,
+		MaxFileSize:       *flMaxFileSize,
+		MinJPEGQuality:    *flMinJPEGQuality,
+		AllowDownscale:    *flAllowDownscale,
+	}
+
+	switch portraitConfig.Style {
+	case facedetect.StyleNone, facedetect.StyleGrayscale, facedetect.StyleSepia, facedetect.StyleDuotone:
+	default:
+		fmt.Printf("unknown -style (%s)\n", *flStyle)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if portraitConfig.GrayscaleWeights, err = parseWeights(*flGrayWeights); err != nil {
+		fmt.Printf("could not parse -gray-weights (%s): %v\n", *flGrayWeights, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if portraitConfig.DuotoneShadow, err = parseHexColor(*flDuotoneShadow); err != nil {
+		fmt.Printf("could not parse -duotone-shadow (%s): %v\n", *flDuotoneShadow, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if portraitConfig.DuotoneHighlight, err = parseHexColor(*flDuotoneHighlight); err != nil {
+		fmt.Printf("could not parse -duotone-highlight (%s): %v\n", *flDuotoneHighlight, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *flBackground != "" {
+		portraitConfig.ReplaceBackground = true
+		if portraitConfig.BackgroundColor, err = parseHexColor(*flBackground); err != nil {
+			fmt.Printf("could not parse -background (%s): %v\n", *flBackground, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	switch portraitConfig.Mask {
+	case facedetect.MaskNone, facedetect.MaskCircle, facedetect.MaskRoundedRect, facedetect.MaskEllipse:
+	default:
+		fmt.Printf("unknown -mask (%s)\n", *flMask)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	switch portraitConfig.Format {
+	case facedetect.FormatAuto, facedetect.FormatJPEG, facedetect.FormatPNG, facedetect.FormatGIF, facedetect.FormatBMP, facedetect.FormatTIFF:
+	default:
+		fmt.Printf("unknown -format (%s)\n", *flFormat)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if portraitConfig.JPEGQuality < 1 || portraitConfig.JPEGQuality > 100 {
+		fmt.Printf("invalid -jpeg-quality (%d): must be between 1 and 100\n", *flJPEGQuality)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if portraitConfig.PNGCompression, err = parsePNGCompression(*flPNGCompression); err != nil {
+		fmt.Printf("could not parse -png-compression (%s): %v\n", *flPNGCompression, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	switch *flFailPolicy {
+	case failPolicyAny, failPolicyThreshold, failPolicyFailFast, failPolicyNone:
+	default:
+		fmt.Printf("unknown -fail-policy (%s)\n", *flFailPolicy)
+		flag.Usage()
+		os.Exit(1)
 	}
 
 	level := new(slog.Level)
@@ -64,15 +222,135 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: *level}))
+	var progress *progressLine
+	switch *flProgress {
+	case "auto":
+		if isTerminal(os.Stderr) {
+			progress = &progressLine{w: os.Stderr}
+		}
+	case "always":
+		progress = &progressLine{w: os.Stderr}
+	case "never":
+	default:
+		fmt.Printf("unknown -progress (%s)\n", *flProgress)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var logOutput io.Writer = os.Stderr
+	if progress != nil {
+		logOutput = progress
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: *level}))
+
+	if *flRoster != "" {
+		columns, err := parseRosterColumns(*flRosterColumns)
+		if err != nil {
+			fmt.Printf("could not parse -roster-columns (%s): %v\n", *flRosterColumns, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		if roster, err = readRoster(*flRoster, columns); err != nil {
+			fmt.Printf("could not read roster: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		if infiles, err = convert.ExpandInputs(infiles, splitList(*flInclude), splitList(*flExclude), logger); err != nil {
+			fmt.Printf("could not find inputs: %v\n", err)
+			os.Exit(1)
+		}
+		if len(infiles) == 0 {
+			fmt.Println("no input files found")
+			os.Exit(1)
+		}
+	}
 
 	opts := []convert.ConvertOption{
 		convert.WithWorkers(*flWorkers),
+		convert.WithDecodeWorkers(*flDecodeWorkers),
+		convert.WithEncodeWorkers(*flEncodeWorkers),
+		convert.WithQueueSize(*flQueueSize),
+		convert.WithMemoryBudget(*flMemoryBudget << 20),
 		convert.WithOverwrite(*flOverwrite),
+		convert.WithManifest(*flManifest),
+		convert.WithPrune(*flPrune),
 		convert.WithPortraitConfig(portraitConfig),
 		convert.WithEXIF(*flUseEXIF),
 		convert.WithLogger(logger),
+		convert.WithFailFast(*flFailPolicy == failPolicyFailFast),
+		convert.WithBaseDir(*flBaseDir),
+		convert.WithCollisionPolicy(convert.CollisionPolicy(*flCollision)),
+		convert.WithNameTemplate(*flNameTemplate),
+		convert.WithQuarantine(*flQuarantine),
+		convert.WithDryRun(*flDryRun),
+		convert.WithSidecars(*flSidecars),
+		convert.WithRetries(retries...),
+	}
+	if progress != nil {
+		opts = append(opts, convert.WithProgress(progress.update))
+	}
+
+	var resultLog *os.File
+	switch *flResultLog {
+	case "":
+	case "-":
+		opts = append(opts, convert.WithResultLog(os.Stdout))
+	default:
+		if resultLog, err = os.Create(*flResultLog); err != nil {
+			logger.Error("could not create result log", "path", *flResultLog, "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, convert.WithResultLog(resultLog))
+	}
+
+	// drain gracefully on the first signal; a second signal exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		logger.Warn("received signal; finishing in-flight conversions. Signal again to exit immediately")
+		stop()
+	}()
+
+	var report *convert.Report
+	if roster != nil {
+		report, err = convert.ConvertRoster(ctx, cascade.Detector, roster, *flOutPath, opts...)
+	} else {
+		report, err = convert.ConvertPortraitsContext(ctx, cascade.Detector, infiles, *flOutPath, opts...)
+	}
+	if progress != nil {
+		progress.clear()
+	}
+	if resultLog != nil {
+		if err := resultLog.Close(); err != nil {
+			logger.Error("could not close result log", "path", *flResultLog, "error", err)
+		}
+	}
+	if err != nil {
+		os.Exit(1)
 	}
 
-	convert.ConvertPortraits(cascade.Detector, infiles, *flOutPath, opts...)
+	if *flDryRun {
+		// keep the result log's JSON Lines stream intact when it's written to stdout
+		var w io.Writer = os.Stdout
+		if *flResultLog == "-" {
+			w = os.Stderr
+		}
+		printDetections(w, report)
+	}
+	printSummary(os.Stderr, report, *flDryRun)
+
+	if *flRosterStatus != "" {
+		if err := writeRosterStatus(*flRosterStatus, roster, report); err != nil {
+			logger.Error("could not write roster status", "path", *flRosterStatus, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
+
+	if shouldFail(report, *flFailPolicy, *flFailThreshold) {
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	convert "github.com/korylprince/go-face-detect/converter"
+)
+
+const clearLine = "\r\033[K"
+
+// isTerminal returns true if f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressLine renders a progress line at the bottom of a terminal.
+// Writes to progressLine (e.g. log messages) are printed above the progress line
+type progressLine struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+func (p *progressLine) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.line != "" {
+		io.WriteString(p.w, clearLine)
+	}
+	n, err := p.w.Write(b)
+	if p.line != "" {
+		io.WriteString(p.w, p.line)
+	}
+	return n, err
+}
+
+// update renders the progress line for pr
+func (p *progressLine) update(pr convert.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.line = fmt.Sprintf("[%d/%d] %d%%", pr.Completed, pr.Total, pr.Completed*100/pr.Total)
+	if pr.Failed > 0 {
+		p.line += fmt.Sprintf(", %d failed", pr.Failed)
+	}
+	if pr.ETA > 0 {
+		p.line += fmt.Sprintf(", ETA %v", pr.ETA.Round(time.Second))
+	}
+	io.WriteString(p.w, clearLine+p.line)
+}
+
+// clear removes the progress line
+func (p *progressLine) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.line != "" {
+		io.WriteString(p.w, clearLine)
+		p.line = ""
+	}
+}
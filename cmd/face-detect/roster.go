@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	convert "github.com/korylprince/go-face-detect/converter"
+)
+
+// readRoster reads the roster CSV at path, resolving photo paths relative to its directory
+func readRoster(path string, columns convert.RosterColumns) (*convert.Roster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open roster: %w", err)
+	}
+	defer f.Close()
+
+	return convert.ReadRoster(f, columns, filepath.Dir(path))
+}
+
+// writeRosterStatus writes roster with the status of each row from report to path
+func writeRosterStatus(path string, roster *convert.Roster, report *convert.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create roster status: %w", err)
+	}
+
+	if err = roster.WriteStatus(f, report); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
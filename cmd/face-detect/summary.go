@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	convert "github.com/korylprince/go-face-detect/converter"
+)
+
+const (
+	failPolicyAny       = "any"
+	failPolicyThreshold = "threshold"
+	failPolicyFailFast  = "fail-fast"
+	failPolicyNone      = "none"
+)
+
+// shouldFail returns true if report fails policy
+func shouldFail(report *convert.Report, policy string, threshold float64) bool {
+	switch policy {
+	case failPolicyAny, failPolicyFailFast:
+		return report.Failed > 0
+	case failPolicyThreshold:
+		if len(report.Results) == 0 {
+			return false
+		}
+		return float64(report.Failed)/float64(len(report.Results))*100 > threshold
+	}
+	return false
+}
+
+// printSummary writes a summary of report to w, reporting detections instead of conversions if dryRun is set
+func printSummary(w io.Writer, report *convert.Report, dryRun bool) {
+	if dryRun {
+		fmt.Fprintf(w, "%d inputs in %v: %d detected, %d failed, %d cancelled\n",
+			len(report.Results), report.Duration.Round(time.Millisecond), report.Detected, report.Failed, report.Cancelled,
+		)
+	} else {
+		fmt.Fprintf(w, "%d inputs in %v: %d converted, %d skipped, %d unchanged, %d failed, %d cancelled, %d pruned\n",
+			len(report.Results), report.Duration.Round(time.Millisecond),
+			report.Converted, report.Skipped, report.Unchanged, report.Failed, report.Cancelled, len(report.Pruned),
+		)
+	}
+	for _, r := range report.Results {
+		if r.Status == convert.StatusFailed {
+			fmt.Fprintf(w, "  failed: %s (%s): %v\n", r.InputPath, r.Category, r.Err)
+		}
+	}
+}
+
+// printDetections writes a line describing the detection of each input in report to w
+func printDetections(w io.Writer, report *convert.Report) {
+	for _, r := range report.Results {
+		d := r.Detection
+		if d == nil {
+			fmt.Fprintf(w, "%s: %s\n", r.InputPath, r.Status)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s, %d faces", r.InputPath, r.Status, d.Faces)
+		if d.Face != nil {
+			b := d.Face.Bounds
+			fmt.Fprintf(w, ", chosen face at (%d, %d) size %d quality %.1f", b.Col, b.Row, b.Scale, b.Q)
+			if d.PupilsDetected {
+				fmt.Fprint(w, ", pupils detected")
+			} else {
+				fmt.Fprint(w, ", pupils undetected")
+			}
+		}
+		if r.Strategy != "" {
+			fmt.Fprintf(w, ", found by %s retry", r.Strategy)
+		}
+		if !d.Crop.Empty() {
+			fmt.Fprintf(w, ", rotated %.1f°, portrait %dx%d", d.Angle, d.Crop.Dx(), d.Crop.Dy())
+		}
+		fmt.Fprintln(w)
+	}
+}
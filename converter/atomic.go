@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix is the prefix of temporary files written to the output directory
+const tempPrefix = ".face-detect-tmp-"
+
+// writeAtomic calls write with a temporary file in the same directory as path, then renames the file to path.
+// The temporary file is removed if writing fails or panics, or ctx is done before the rename,
+// so path is either written completely or not at all
+func writeAtomic(ctx context.Context, path string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*"+filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %w", err)
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return fmt.Errorf("could not set temporary file permissions: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("could not sync temporary file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not close temporary file: %w", err)
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not rename temporary file: %w", err)
+	}
+	renamed = true
+
+	return nil
+}
+
+// removeTempFiles removes temporary files left in outdir by interrupted runs, returning the removed paths
+func removeTempFiles(outdir string) ([]string, error) {
+	var removed []string
+	err := filepath.WalkDir(outdir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
+}
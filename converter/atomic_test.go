@@ -0,0 +1,115 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// dirNames returns the names of the entries in dir, sorted
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for idx, e := range entries {
+		names[idx] = e.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWriteAtomic(t *testing.T) {
+	errWrite := errors.New("write failed")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		write func(w io.Writer) error
+		err   error
+	}{
+		{"written", context.Background(), func(w io.Writer) error { _, err := io.WriteString(w, "output"); return err }, nil},
+		{"write error", context.Background(), func(w io.Writer) error { io.WriteString(w, "partial"); return errWrite }, errWrite},
+		{"cancelled", cancelled, func(w io.Writer) error { _, err := io.WriteString(w, "output"); return err }, context.Canceled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "jdoe.jpg")
+			err := writeAtomic(test.ctx, path, test.write)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+
+			names := dirNames(t, dir)
+			if test.err != nil {
+				if len(names) != 0 {
+					t.Errorf("failed write left %v", names)
+				}
+				return
+			}
+			if len(names) != 1 || names[0] != "jdoe.jpg" {
+				t.Errorf("directory contains %v, want [jdoe.jpg]", names)
+			}
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "output" {
+				t.Errorf("content = %q, want %q", buf, "output")
+			}
+		})
+	}
+}
+
+func TestWriteAtomicPanic(t *testing.T) {
+	dir := t.TempDir()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("write didn't panic")
+			}
+		}()
+		writeAtomic(context.Background(), filepath.Join(dir, "jdoe.jpg"), func(w io.Writer) error { panic("write panicked") })
+	}()
+	if names := dirNames(t, dir); len(names) != 0 {
+		t.Errorf("panicked write left %v", names)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	outdir := t.TempDir()
+	temps := []string{filepath.Join(outdir, tempPrefix+"1.jpg"), filepath.Join(outdir, "staff", tempPrefix+"2.png")}
+	kept := []string{filepath.Join(outdir, "jdoe.jpg"), filepath.Join(outdir, "staff", "asmith.png")}
+	for _, path := range append(temps, kept...) {
+		writeFile(t, path, "output")
+	}
+
+	removed, err := removeTempFiles(outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	if len(removed) != len(temps) || removed[0] != temps[0] || removed[1] != temps[1] {
+		t.Errorf("removed = %v, want %v", removed, temps)
+	}
+	for _, path := range temps {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s wasn't removed", path)
+		}
+	}
+	for _, path := range kept {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// bytesPerPixel is the estimated memory used to convert an input per pixel:
+// the decoded NRGBA image, its rotated copy, and the intermediate images used for detection and rendering.
+// Retry strategies frame copies of the input while it's still held, so their copies are charged at the same rate
+const bytesPerPixel = 12
+
+// memoryBudget is a weighted semaphore limiting the estimated memory used by inputs being converted
+type memoryBudget struct {
+	mu   sync.Mutex
+	size int64
+	used int64
+	// released is closed and replaced when memory is released
+	released chan struct{}
+}
+
+func newMemoryBudget(size int64) *memoryBudget {
+	return &memoryBudget{size: size, released: make(chan struct{})}
+}
+
+// acquire blocks until n bytes are available or ctx is done.
+// Inputs larger than the budget are admitted when nothing else is using it
+func (b *memoryBudget) acquire(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= b.size {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.released
+		b.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes to the budget
+func (b *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	close(b.released)
+	b.released = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// retryPixels returns the number of pixels in the largest copy of a w x h input framed by any of retries.
+// Copies are framed one at a time, so only the largest is held along with the input
+func retryPixels(retries []RetryStrategy, w, h int) int64 {
+	var largest int64
+	for _, strategy := range retries {
+		var pixels int64
+		switch strategy {
+		case RetryOrient, RetryEqualize:
+			pixels = int64(w) * int64(h)
+		case RetryRotate:
+			// rotations that aren't multiples of 90 degrees make larger copies to fit the rotated corners
+			for _, angle := range retryAngles {
+				b := facedetect.RotatedBounds(image.Rect(0, 0, w, h), angle)
+				if p := int64(b.Dx()) * int64(b.Dy()); p > pixels {
+					pixels = p
+				}
+			}
+		case RetryUpscale:
+			if upscalable(w, h) {
+				pixels = 4 * int64(w) * int64(h)
+			}
+		}
+		if pixels > largest {
+			largest = pixels
+		}
+	}
+	return largest
+}
+
+// imageCost returns the estimated memory in bytes used to convert the image at path, from its dimensions,
+// including the largest copy framed by retries
+func imageCost(path string, retries []RetryStrategy) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not open image: %w", err)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, fmt.Errorf("could not decode image config: %w", err)
+	}
+
+	pixels := int64(cfg.Width)*int64(cfg.Height) + retryPixels(retries, cfg.Width, cfg.Height)
+
+	return pixels * bytesPerPixel, nil
+}
+
+// admit waits until the memory budget has room for the input of j, if c.budget is set.
+// The memory used by retries is charged up front, since acquiring more while holding some could deadlock.
+// If the input's dimensions can't be read, it's admitted without waiting so decoding reports the error
+func (c *config) admit(ctx context.Context, j *job) error {
+	if c.budget == nil {
+		return nil
+	}
+
+	cost, err := imageCost(j.r.InputPath, c.retries)
+	if err != nil {
+		c.logger.Debug("could not estimate image memory", "input_path", j.r.InputPath, "error", err)
+		return nil
+	}
+
+	if err = c.budget.acquire(ctx, cost); err != nil {
+		return err
+	}
+	j.cost = cost
+	c.logger.Debug("admitted input", "input_path", j.r.InputPath, "memory", cost)
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// acquireAsync acquires n bytes from b in a goroutine, returning a channel that receives the result
+func acquireAsync(ctx context.Context, b *memoryBudget, n int64) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- b.acquire(ctx, n)
+	}()
+	return done
+}
+
+// blocked returns true if nothing is received from done within a short time
+func blocked(done <-chan error) bool {
+	select {
+	case <-done:
+		return false
+	case <-time.After(50 * time.Millisecond):
+		return true
+	}
+}
+
+func TestMemoryBudgetOversized(t *testing.T) {
+	b := newMemoryBudget(100)
+	if err := b.acquire(context.Background(), 500); err != nil {
+		t.Fatalf("oversized input wasn't admitted to an empty budget: %v", err)
+	}
+
+	done := acquireAsync(context.Background(), b, 10)
+	if !blocked(done) {
+		t.Fatal("input was admitted alongside an oversized input")
+	}
+
+	b.release(500)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("input wasn't admitted after release")
+	}
+	if b.used != 10 {
+		t.Errorf("used = %d, want 10", b.used)
+	}
+}
+
+func TestMemoryBudgetBlocksUntilRelease(t *testing.T) {
+	b := newMemoryBudget(100)
+	for _, n := range []int64{60, 40} {
+		if err := b.acquire(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := acquireAsync(context.Background(), b, 50)
+	if !blocked(done) {
+		t.Fatal("input was admitted over the budget")
+	}
+
+	// releasing too little wakes the waiter, but it keeps waiting
+	b.release(40)
+	if !blocked(done) {
+		t.Fatal("input was admitted over the budget after a partial release")
+	}
+
+	b.release(60)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("input wasn't admitted after release")
+	}
+}
+
+func TestMemoryBudgetCancel(t *testing.T) {
+	b := newMemoryBudget(100)
+	if err := b.acquire(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := acquireAsync(ctx, b, 10)
+	if !blocked(done) {
+		t.Fatal("input was admitted over the budget")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire didn't return after cancellation")
+	}
+	if b.used != 100 {
+		t.Errorf("used = %d, want 100", b.used)
+	}
+}
+
+func TestImageCost(t *testing.T) {
+	dir := t.TempDir()
+
+	// the largest copy made by RetryRotate, rotated like the strategy does
+	var rotated int64
+	for _, angle := range retryAngles {
+		b := imaging.Rotate(image.NewNRGBA(image.Rect(0, 0, 100, 50)), angle, color.NRGBA{}).Bounds()
+		if p := int64(b.Dx()) * int64(b.Dy()); p > rotated {
+			rotated = p
+		}
+	}
+	if rotated <= 100*50 {
+		t.Fatalf("largest rotated copy has %d pixels, want more than the input", rotated)
+	}
+
+	tests := []struct {
+		w, h    int
+		retries []RetryStrategy
+		want    int64
+	}{
+		{100, 50, nil, 100 * 50 * bytesPerPixel},
+		{100, 50, []RetryStrategy{RetryRelaxed}, 100 * 50 * bytesPerPixel},
+		{100, 50, []RetryStrategy{RetryEqualize, RetryRelaxed}, 2 * 100 * 50 * bytesPerPixel},
+		{100, 50, []RetryStrategy{RetryRotate}, (100*50 + rotated) * bytesPerPixel},
+		{100, 50, []RetryStrategy{RetryUpscale}, 5 * 100 * 50 * bytesPerPixel},
+		{100, 50, DefaultRetryStrategies, 5 * 100 * 50 * bytesPerPixel},
+		{retryUpscaleMaxSize, 10, []RetryStrategy{RetryUpscale}, retryUpscaleMaxSize * 10 * bytesPerPixel},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, test.w, test.h))); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "input.png")
+		writeFile(t, path, buf.String())
+
+		cost, err := imageCost(path, test.retries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost != test.want {
+			t.Errorf("%dx%d (retries %v): cost = %d, want %d", test.w, test.h, test.retries, cost, test.want)
+		}
+	}
+
+	if _, err := imageCost(filepath.Join(dir, "missing.png"), nil); err == nil {
+		t.Error("missing image: expected error")
+	}
+}
@@ -1,61 +1,100 @@
 package convert
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
+	"io"
 	"os"
-	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
-	"github.com/disintegration/imaging"
 	pigo "github.com/esimov/pigo/core"
 	facedetect "github.com/korylprince/go-face-detect"
 	"golang.org/x/exp/slog"
 )
 
-func convertPortrait(c *config, inpath, outpath string) error {
+// errSkipped is returned by pipeline stages when the output already exists and shouldn't be overwritten
+var errSkipped = errors.New("output exists")
+
+var ErrPanic = errors.New("conversion panicked")
+
+// skipExisting returns true if the output for r exists and shouldn't be overwritten.
+// Outputs recorded in the manifest are always overwritten
+func (c *config) skipExisting(r *Result) bool {
+	if _, err := os.Stat(r.OutputPath); errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if !c.overwrite && !c.tracked(r) {
+		c.logger.Debug("not overwriting existing file", "input_path", r.InputPath, "output_path", r.OutputPath)
+		return true
+	}
+	c.logger.Debug("overwriting file", "input_path", r.InputPath, "output_path", r.OutputPath)
+	return false
+}
+
+// decode decodes the input of r, applying its EXIF orientation if c.useEXIF is set
+func (c *config) decode(r *Result) (*image.NRGBA, error) {
 	var (
 		img *image.NRGBA
 		err error
 	)
 	if c.useEXIF {
-		img, err = facedetect.DecodeFileWithEXIF(inpath)
+		img, err = facedetect.DecodeFileWithEXIF(r.InputPath)
 	} else {
-		img, err = pigo.GetImage(inpath)
+		img, err = pigo.GetImage(r.InputPath)
 	}
 	if err != nil {
 		if img == nil {
-			return fmt.Errorf("could not read image: %w", err)
+			return nil, fmt.Errorf("could not read image: %w", err)
 		}
-		c.logger.Debug("could not parse EXIF data", "input_path", inpath, "error", err)
-	}
-
-	portrait, err := c.detector.Portrait(img, c.portraitConfig)
-	if err != nil {
-		return err
+		c.logger.Debug("could not parse EXIF data", "input_path", r.InputPath, "error", err)
 	}
 
-	if err = imaging.Save(portrait, outpath); err != nil {
-		return fmt.Errorf("could not write portrait: %w", err)
-	}
-
-	return nil
+	return img, nil
 }
 
 type config struct {
-	detector       *facedetect.Detector
-	workers        int
-	overwrite      bool
-	useEXIF        bool
-	logger         *slog.Logger
-	portraitConfig *facedetect.PortraitConfig
+	detector        *facedetect.Detector
+	workers         int
+	decodeWorkers   int
+	encodeWorkers   int
+	queueSize       int
+	memoryBudget    int64
+	budget          *memoryBudget
+	overwrite       bool
+	useEXIF         bool
+	failFast        bool
+	stop            chan struct{}
+	baseDir         string
+	collisionPolicy CollisionPolicy
+	foldCase        bool
+	planned         map[string]*Result
+	nameTemplate    string
+	useManifest     bool
+	prune           bool
+	manifest        *manifest
+	settings        string
+	progressFn      func(Progress)
+	quarantineDir   string
+	quarantinePaths map[*Result]string
+	dryRun          bool
+	resultLog       *resultLog
+	roster          []*RosterEntry
+	fromRoster      bool
+	sidecars        bool
+	retries         []RetryStrategy
+	progress        *progressTracker
+	logger          *slog.Logger
+	portraitConfig  *facedetect.PortraitConfig
 }
 
 type ConvertOption func(*config)
 
-// WithWorkers configures the number concurrent workers.
+// WithWorkers configures the number of concurrent detection workers, which also renders portraits.
+// It's the default for WithDecodeWorkers, WithEncodeWorkers, and WithQueueSize.
 // The default is runtime.NumCPU()
 func WithWorkers(workers int) ConvertOption {
 	return func(c *config) {
@@ -63,7 +102,44 @@ func WithWorkers(workers int) ConvertOption {
 	}
 }
 
+// WithDecodeWorkers configures the number of concurrent workers reading and decoding inputs.
+// The default is the number of workers set with WithWorkers
+func WithDecodeWorkers(workers int) ConvertOption {
+	return func(c *config) {
+		c.decodeWorkers = workers
+	}
+}
+
+// WithEncodeWorkers configures the number of concurrent workers encoding and writing portraits.
+// The default is the number of workers set with WithWorkers
+func WithEncodeWorkers(workers int) ConvertOption {
+	return func(c *config) {
+		c.encodeWorkers = workers
+	}
+}
+
+// WithQueueSize configures the number of images queued between the decode, detect, and encode stages.
+// At most decode workers + queue size + detect workers + queue size + encode workers images are held in memory at once.
+// The default is the number of workers set with WithWorkers
+func WithQueueSize(size int) ConvertOption {
+	return func(c *config) {
+		c.queueSize = size
+	}
+}
+
+// WithMemoryBudget limits the estimated memory in bytes used by inputs being converted.
+// Inputs are admitted by their pixel count, read from their headers before decoding, so fewer large inputs are converted at once.
+// When retries are enabled with WithRetries, inputs are also charged for the largest copy the retries frame,
+// e.g. an upscaled copy for RetryUpscale or a copy rotated 40 degrees for RetryRotate.
+// Inputs larger than the budget are converted one at a time. The default is 0, which disables the budget
+func WithMemoryBudget(bytes int64) ConvertOption {
+	return func(c *config) {
+		c.memoryBudget = bytes
+	}
+}
+
 // WithOverwrite configures the converter to overwrite existing images.
+// With WithManifest, every input is reprocessed, even if it's unchanged.
 // The default is false
 func WithOverwrite(overwrite bool) ConvertOption {
 	return func(c *config) {
@@ -71,6 +147,134 @@ func WithOverwrite(overwrite bool) ConvertOption {
 	}
 }
 
+// WithFailFast configures the converter to stop converting inputs after the first failure.
+// Inputs already in a stage finish it, and inputs that weren't converted, including those queued between stages,
+// are reported with StatusCancelled.
+// The default is false
+func WithFailFast(failFast bool) ConvertOption {
+	return func(c *config) {
+		c.failFast = failFast
+	}
+}
+
+// WithBaseDir configures the converter to preserve the directory structure of inputs relative to baseDir in the output directory.
+// Inputs outside of baseDir fail with CategoryOutputPath.
+// The default is "", which writes all outputs directly in the output directory
+func WithBaseDir(baseDir string) ConvertOption {
+	return func(c *config) {
+		c.baseDir = baseDir
+	}
+}
+
+// WithCollisionPolicy configures how the converter handles multiple inputs with the same output path.
+// The default is CollisionError
+func WithCollisionPolicy(policy CollisionPolicy) ConvertOption {
+	return func(c *config) {
+		c.collisionPolicy = policy
+	}
+}
+
+// WithNameTemplate configures the template used to name outputs. The following placeholders are expanded:
+//   - {base}: the input file name without its extension
+//   - {ext}: the input file extension, including the leading dot
+//   - {width}, {height}: the dimensions of the converted portrait
+//   - {preset}: the Name of the PortraitConfig
+//   - {hash}: the first 12 hex characters of the SHA-256 hash of the input file
+//   - {index}: the 1-based position of the input in the list of inputs
+//   - {id}, {name}: the ID and name of the input's roster entry, with characters not allowed in file names replaced (requires ConvertRoster)
+//
+// The extension is changed to match the output format as described in facedetect.PortraitConfig.OutputPath.
+// The default is DefaultNameTemplate
+func WithNameTemplate(template string) ConvertOption {
+	return func(c *config) {
+		c.nameTemplate = template
+	}
+}
+
+// WithManifest configures the converter to keep a manifest (ManifestName) in the output directory
+// recording the hashes of each input, the conversion settings, and each output.
+// Inputs whose content and settings haven't changed since their output was written are skipped with StatusUnchanged
+// unless WithOverwrite is set,
+// and outputs recorded in the manifest are reprocessed when they have changed, even without WithOverwrite.
+// The default is false
+func WithManifest(useManifest bool) ConvertOption {
+	return func(c *config) {
+		c.useManifest = useManifest
+	}
+}
+
+// WithPrune configures the converter to remove outputs recorded in the manifest whose inputs no longer exist.
+// Pruning requires WithManifest. The default is false
+func WithPrune(prune bool) ConvertOption {
+	return func(c *config) {
+		c.prune = prune
+	}
+}
+
+// WithProgress configures the converter to call fn with a Progress event when each input starts and finishes.
+// fn is called from multiple goroutines, but never concurrently.
+// The default is nil, which doesn't send progress events
+func WithProgress(fn func(Progress)) ConvertOption {
+	return func(c *config) {
+		c.progressFn = fn
+	}
+}
+
+// WithQuarantine configures the converter to copy failed inputs to dir,
+// along with a JSON report (<name>.quarantine.json) describing the failure and the faces and pupils detected,
+// and a debug image (<name>.debug.png) with the detections drawn on the input.
+// ExpandInputs skips reports and debug images, so the quarantined inputs can be corrected with sidecars and converted again.
+// If WithBaseDir is set, the input's directory relative to it is preserved under dir.
+// Inputs that fail because of their output path aren't quarantined.
+// The default is "", which doesn't quarantine inputs
+func WithQuarantine(dir string) ConvertOption {
+	return func(c *config) {
+		c.quarantineDir = dir
+	}
+}
+
+// WithDryRun configures the converter to decode inputs and frame their portraits without writing anything.
+// Framed inputs have StatusDetected, and each Result's Detection describes the faces found and the predicted crop.
+// Manifests, pruning, and quarantining are disabled for dry runs, and existing outputs are ignored
+func WithDryRun(dryRun bool) ConvertOption {
+	return func(c *config) {
+		c.dryRun = dryRun
+	}
+}
+
+// WithResultLog configures the converter to write a JSON object describing each input's result to w, one per line.
+// Each object contains the input and output paths, status, error, detected face and pupils, rotation angle, crop, and timings.
+// The default is nil, which doesn't write a result log
+func WithResultLog(w io.Writer) ConvertOption {
+	return func(c *config) {
+		c.resultLog = newResultLog(w)
+	}
+}
+
+// WithSidecars configures whether the converter applies sidecar files (the input path + SidecarExt) containing manual corrections.
+// A sidecar is a JSON object with any of the following fields:
+//   - face: the face bounding box ({"x", "y", "width", "height"}), skipping face detection
+//   - left_eye, right_eye: the pupil positions ({"x", "y"}), skipping pupil detection if both are given
+//   - rotation: the counter-clockwise rotation in degrees, instead of leveling the pupils
+//   - config: facedetect.PortraitConfig fields (e.g. {"Headroom": 0.1}) overriding the converter's config for the input
+//
+// Coordinates are in pixels of the decoded input, after applying its EXIF orientation if enabled.
+// Inputs with invalid sidecars fail with CategorySidecar. The default is true
+func WithSidecars(sidecars bool) ConvertOption {
+	return func(c *config) {
+		c.sidecars = sidecars
+	}
+}
+
+// WithRetries configures the strategies tried in order when a face or its pupils can't be detected in an input,
+// until one succeeds. The strategy that succeeded is recorded in Result.Strategy.
+// Inputs whose sidecar sets the face, eyes or rotation aren't retried. The default is nil, which doesn't retry
+func WithRetries(strategies ...RetryStrategy) ConvertOption {
+	return func(c *config) {
+		c.retries = strategies
+	}
+}
+
 // WithPortraitConfig configures the PortraitConfig for converting portraits.
 // The default is facedetect.DefaultPortraitConfig
 func WithPortraitConfig(pc *facedetect.PortraitConfig) ConvertOption {
@@ -95,59 +299,225 @@ func WithLogger(logger *slog.Logger) ConvertOption {
 	}
 }
 
-func worker(wg *sync.WaitGroup, c *config, outdir string, in chan string) {
-	defer wg.Done()
-	for inpath := range in {
-		outpath := filepath.Join(outdir, filepath.Base(inpath))
+// finish reports the completion of r to the progress callback and result log
+func (c *config) finish(r *Result) {
+	c.progress.done(r)
+	if err := c.resultLog.write(r); err != nil {
+		c.logger.Warn("could not write result log", "input_path", r.InputPath, "error", err)
+	}
+}
 
-		if _, err := os.Stat(outpath); !errors.Is(err, os.ErrNotExist) && !c.overwrite {
-			c.logger.Debug("not overwriting existing file", "input_path", inpath, "output_path", outpath)
-			continue
-		} else if !errors.Is(err, os.ErrNotExist) && c.overwrite {
-			c.logger.Debug("overwriting file", "input_path", inpath, "output_path", outpath)
-		}
-		if err := convertPortrait(c, inpath, outpath); err != nil {
-			c.logger.Error("conversion failed", "input_path", inpath, "output_path", outpath, "error", err)
-		} else {
-			c.logger.Info("portrait converted", "input_path", inpath, "output_path", outpath)
-		}
+// stopped returns true if ctx is done or stop is closed
+func stopped(ctx context.Context, stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
 	}
 }
 
 // ConvertPortraits concurrently converts the images at paths given in infiles to portraits and outputs the results to outpath.
-// It's recommended to use the embedded cascade.Detector. Check ConvertOption for configurable options
-func ConvertPortraits(detector *facedetect.Detector, infiles []string, outdir string, opts ...ConvertOption) {
+// It's recommended to use the embedded cascade.Detector. Check ConvertOption for configurable options.
+// The returned Report contains the result of each input. An error is only returned if the conversion couldn't be started
+func ConvertPortraits(detector *facedetect.Detector, infiles []string, outdir string, opts ...ConvertOption) (*Report, error) {
+	return ConvertPortraitsContext(context.Background(), detector, infiles, outdir, opts...)
+}
+
+// ConvertPortraitsContext is like ConvertPortraits, but stops converting when ctx is done.
+// In-flight inputs finish converting, but their outputs are discarded if ctx is done before they're written.
+// Inputs that weren't converted are reported with StatusCancelled
+func ConvertPortraitsContext(ctx context.Context, detector *facedetect.Detector, infiles []string, outdir string, opts ...ConvertOption) (*Report, error) {
+	start := time.Now()
 	c := &config{
-		detector:       detector,
-		workers:        runtime.NumCPU(),
-		useEXIF:        true,
-		logger:         slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})),
-		portraitConfig: facedetect.DefaultPortraitConfig,
+		detector:        detector,
+		workers:         runtime.NumCPU(),
+		useEXIF:         true,
+		sidecars:        true,
+		logger:          slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})),
+		portraitConfig:  facedetect.DefaultPortraitConfig,
+		nameTemplate:    DefaultNameTemplate,
+		collisionPolicy: CollisionError,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
 
-	if err := os.MkdirAll(outdir, 0755); err != nil {
-		c.logger.Error("could not create output directory", "path", outdir, "error", err)
-		return
+	if err := validateNameTemplate(c.nameTemplate); err != nil {
+		c.logger.Error("invalid name template", "template", c.nameTemplate, "error", err)
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	if err := validateNameExt(c.nameTemplate, c.portraitConfig); err != nil {
+		c.logger.Error("invalid name template", "template", c.nameTemplate, "error", err)
+		return nil, err
+	}
+	if err := ValidateRetryStrategies(c.retries); err != nil {
+		c.logger.Error("invalid retry strategies", "error", err)
+		return nil, err
+	}
+	if c.fromRoster && len(c.roster) == 0 {
+		c.logger.Error("roster has no rows with photos")
+		return nil, errors.New("roster has no rows with photos")
+	}
+	if c.roster == nil && usesRoster(c.nameTemplate) {
+		c.logger.Error("name template uses roster placeholders without a roster", "template", c.nameTemplate)
+		return nil, errors.New("invalid name template: {id} and {name} require a roster")
+	}
+
+	// dry runs don't write anything
+	if c.dryRun {
+		c.useManifest, c.prune, c.quarantineDir = false, false, ""
+	} else {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			c.logger.Error("could not create output directory", "path", outdir, "error", err)
+			return nil, fmt.Errorf("could not create output directory: %w", err)
+		}
+
+		if removed, err := removeTempFiles(outdir); err != nil {
+			c.logger.Warn("could not remove temporary files", "path", outdir, "error", err)
+		} else {
+			for _, path := range removed {
+				c.logger.Debug("removed temporary file from interrupted run", "path", path)
+			}
+		}
+	}
+
+	if c.decodeWorkers <= 0 {
+		c.decodeWorkers = c.workers
+	}
+	if c.encodeWorkers <= 0 {
+		c.encodeWorkers = c.workers
+	}
+	if c.queueSize <= 0 {
+		c.queueSize = c.workers
+	}
+	if c.memoryBudget > 0 {
+		c.budget = newMemoryBudget(c.memoryBudget)
+	}
+	for _, workers := range []*int{&c.workers, &c.decodeWorkers, &c.encodeWorkers} {
+		if *workers > len(infiles) {
+			*workers = len(infiles)
+		}
+	}
+
+	if c.prune && !c.useManifest {
+		c.logger.Warn("pruning requires a manifest; not pruning")
 	}
 
-	if c.workers > len(infiles) {
-		c.workers = len(infiles)
+	if c.useManifest {
+		var err error
+		if c.manifest, err = loadManifest(outdir); err != nil {
+			c.logger.Warn("could not load manifest; reprocessing all inputs", "error", err)
+		}
+		if c.settings, err = c.settingsHash(); err != nil {
+			c.logger.Error("could not hash settings", "error", err)
+			return nil, err
+		}
 	}
 
-	in := make(chan string)
-	wg := new(sync.WaitGroup)
-	wg.Add(c.workers)
-	for i := 0; i < c.workers; i++ {
-		go worker(wg, c, outdir, in)
+	c.foldCase = caseInsensitive(outdir)
+	report := &Report{Results: c.planOutputs(outdir, infiles)}
+	if c.quarantineDir != "" {
+		c.planQuarantine(report.Results)
 	}
+	c.progress = newProgressTracker(c.progressFn, len(infiles))
 
-	for _, path := range infiles {
-		in <- path
+	// stop is closed to stop converting inputs when failing fast
+	c.stop = make(chan struct{})
+	var once sync.Once
+	fail := func() {
+		if c.failFast {
+			once.Do(func() { close(c.stop) })
+		}
+	}
+
+	complete := func(j *job) {
+		r := j.r
+		r.Duration = time.Since(j.start)
+		if c.budget != nil {
+			c.budget.release(j.cost)
+		}
+		if c.quarantineDir != "" && r.Status == StatusFailed && r.Category != CategoryOutputPath {
+			if err := c.quarantine(r); err != nil {
+				c.logger.Warn("could not quarantine input", "input_path", r.InputPath, "error", err)
+			}
+		}
+		c.finish(r)
+		if r.Status == StatusFailed {
+			fail()
+		}
+	}
+
+	stages := []*stage{
+		{name: "decode", workers: c.decodeWorkers, run: decodeStage},
+		{name: "detect", workers: c.workers, run: detectStage},
+	}
+	if !c.dryRun {
+		stages = append(stages, &stage{name: "encode", workers: c.encodeWorkers, run: encodeStage})
+	}
+
+	in := make(chan *job)
+	done := make(chan struct{})
+	go func() {
+		c.runPipeline(ctx, stages, in, complete)
+		close(done)
+	}()
+
+	for idx, r := range report.Results {
+		if r.Status == StatusFailed {
+			c.logger.Error("conversion failed", "input_path", r.InputPath, "output_path", r.OutputPath, "category", r.Category, "error", r.Err)
+			c.finish(r)
+			fail()
+			continue
+		}
+
+		// check for a stop before feeding so a ready worker can't win the race against a failure or cancellation
+		if !stopped(ctx, c.stop) {
+			select {
+			case in <- &job{r: r}:
+				continue
+			case <-c.stop:
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil {
+			c.logger.Warn("conversion cancelled; finishing in-flight inputs", "remaining", len(infiles)-idx, "error", ctx.Err())
+		} else {
+			c.logger.Warn("stopping conversion after failure", "remaining", len(infiles)-idx)
+		}
+		for _, r := range report.Results[idx:] {
+			if r.Status == "" {
+				r.Status, r.Err = StatusCancelled, ctx.Err()
+				c.finish(r)
+			}
+		}
+		break
 	}
 	close(in)
 
-	wg.Wait()
+	<-done
+
+	if c.manifest != nil {
+		if c.prune && ctx.Err() == nil {
+			pruned, err := c.manifest.prune()
+			if err != nil {
+				c.logger.Error("could not prune outputs", "error", err)
+			}
+			for _, path := range pruned {
+				c.logger.Info("pruned output", "output_path", path)
+			}
+			report.Pruned = pruned
+		}
+		if err := c.manifest.save(); err != nil {
+			c.logger.Error("could not save manifest", "error", err)
+		}
+	}
+
+	report.tally()
+	report.Duration = time.Since(start)
+
+	return report, nil
 }
@@ -0,0 +1,231 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+	"github.com/korylprince/go-face-detect/cascade"
+	"golang.org/x/exp/slog"
+)
+
+// testLogger returns a logger that discards everything but errors
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(new(bytes.Buffer), &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+// writeFile writes content to path, creating its directory
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFixtures writes the named fixtures to dir, returning their paths.
+// face.png contains a face, blank.png is a blank image, and junk.jpg isn't an image.
+// Fixtures in subdirectories (e.g. a/face.png) are written with the contents of their base name
+func writeFixtures(t *testing.T, dir string, names []string) []string {
+	t.Helper()
+	face, err := os.ReadFile(filepath.Join("..", "screenshot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blank := new(bytes.Buffer)
+	if err = png.Encode(blank, image.NewGray(image.Rect(0, 0, 200, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := map[string]string{"face.png": string(face), "blank.png": blank.String(), "junk.jpg": "not an image"}
+	paths := make([]string, len(names))
+	for idx, name := range names {
+		paths[idx] = filepath.Join(dir, filepath.FromSlash(name))
+		writeFile(t, paths[idx], fixtures[filepath.Base(name)])
+	}
+	return paths
+}
+
+// decodeSize returns the dimensions of the image at path
+func decodeSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestOutputDimensions(t *testing.T) {
+	infiles := writeFixtures(t, t.TempDir(), []string{"face.png"})
+	convert := func(portraitConfig *facedetect.PortraitConfig) (path string, width, height int) {
+		outdir := t.TempDir()
+		report, err := ConvertPortraits(cascade.Detector, infiles, outdir, WithLogger(testLogger()),
+			WithPortraitConfig(portraitConfig), WithNameTemplate("{base}-{width}x{height}.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := report.Results[0]
+		if r.Status != StatusConverted {
+			t.Fatalf("status = %q, want %q (error: %v)", r.Status, StatusConverted, r.Err)
+		}
+		width, height = decodeSize(t, r.OutputPath)
+		if want := filepath.Join(outdir, fmt.Sprintf("face-%dx%d.jpg", width, height)); r.OutputPath != want {
+			t.Errorf("output path = %q, want %q", r.OutputPath, want)
+		}
+		return r.OutputPath, width, height
+	}
+
+	_, fullWidth, _ := convert(facedetect.DefaultPortraitConfig)
+
+	// downscaling to fit the file size changes the dimensions after the portrait is rendered
+	capped := *facedetect.DefaultPortraitConfig
+	capped.MaxFileSize = 8000
+	capped.AllowDownscale = true
+	if _, width, height := convert(&capped); width >= fullWidth {
+		t.Errorf("portrait wasn't downscaled: %dx%d", width, height)
+	}
+}
+
+func TestConvertPortraitsContext(t *testing.T) {
+	// either is used in want for inputs that are converted or cancelled, depending on scheduling
+	const either Status = ""
+	rename := WithCollisionPolicy(CollisionRename)
+
+	tests := []struct {
+		name       string
+		detector   *facedetect.Detector
+		inputs     []string
+		opts       []ConvertOption
+		cancel     bool
+		want       []Status
+		categories []ErrorCategory
+		outputs    int
+	}{
+		{
+			name:       "results match inputs",
+			inputs:     []string{"a/face.png", "junk.jpg", "blank.png", "b/face.png"},
+			opts:       []ConvertOption{WithWorkers(2), rename},
+			want:       []Status{StatusConverted, StatusFailed, StatusFailed, StatusConverted},
+			categories: []ErrorCategory{CategoryNone, CategoryDecode, CategoryFaceUndetected, CategoryNone},
+			outputs:    2,
+		},
+		{
+			name:       "fail fast before feeding",
+			inputs:     []string{"a/face.png", "b/face.png", "c/blank.png", "d/junk.jpg"},
+			opts:       []ConvertOption{WithFailFast(true)},
+			want:       []Status{StatusFailed, StatusFailed, StatusCancelled, StatusCancelled},
+			categories: []ErrorCategory{CategoryOutputPath, CategoryOutputPath, CategoryNone, CategoryNone},
+		},
+		{
+			name:   "fail fast in pipeline",
+			inputs: []string{"z/face.png", "blank.png", "a/face.png", "b/face.png", "c/face.png", "d/face.png", "e/face.png"},
+			opts: []ConvertOption{WithFailFast(true), rename, WithWorkers(1), WithDecodeWorkers(1), WithEncodeWorkers(1),
+				WithQueueSize(8)},
+			want: []Status{either, StatusFailed, StatusCancelled, StatusCancelled, StatusCancelled, StatusCancelled, StatusCancelled},
+			categories: []ErrorCategory{CategoryNone, CategoryFaceUndetected, CategoryNone, CategoryNone, CategoryNone,
+				CategoryNone, CategoryNone},
+		},
+		{
+			name:       "cancelled",
+			inputs:     []string{"face.png", "junk.jpg", "blank.png"},
+			cancel:     true,
+			want:       []Status{StatusCancelled, StatusCancelled, StatusCancelled},
+			categories: []ErrorCategory{CategoryNone, CategoryNone, CategoryNone},
+		},
+		{
+			name:       "dry run",
+			inputs:     []string{"face.png", "blank.png"},
+			opts:       []ConvertOption{WithDryRun(true)},
+			want:       []Status{StatusDetected, StatusFailed},
+			categories: []ErrorCategory{CategoryNone, CategoryFaceUndetected},
+		},
+		{
+			name:       "panic",
+			detector:   &facedetect.Detector{Params: cascade.Detector.Params},
+			inputs:     []string{"face.png", "junk.jpg"},
+			want:       []Status{StatusFailed, StatusFailed},
+			categories: []ErrorCategory{CategoryPanic, CategoryDecode},
+		},
+		{
+			name:       "memory budget",
+			inputs:     []string{"a/face.png", "b/face.png", "c/face.png"},
+			opts:       []ConvertOption{WithMemoryBudget(1), WithWorkers(2), rename},
+			want:       []Status{StatusConverted, StatusConverted, StatusConverted},
+			categories: []ErrorCategory{CategoryNone, CategoryNone, CategoryNone},
+			outputs:    3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indir, outdir := t.TempDir(), t.TempDir()
+			infiles := writeFixtures(t, indir, test.inputs)
+			detector := test.detector
+			if detector == nil {
+				detector = cascade.Detector
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				cancel()
+			}
+
+			opts := append([]ConvertOption{WithLogger(testLogger())}, test.opts...)
+			report, err := ConvertPortraitsContext(ctx, detector, infiles, outdir, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Results) != len(infiles) {
+				t.Fatalf("got %d results, want %d", len(report.Results), len(infiles))
+			}
+			for idx, r := range report.Results {
+				if r.InputPath != infiles[idx] {
+					t.Errorf("result %d: input path = %q, want %q", idx, r.InputPath, infiles[idx])
+				}
+				if want := test.want[idx]; want == either && r.Status != StatusConverted && r.Status != StatusCancelled ||
+					want != either && r.Status != want {
+					t.Errorf("result %d: status = %q, want %q (error: %v)", idx, r.Status, want, r.Err)
+				}
+				if r.Category != test.categories[idx] {
+					t.Errorf("result %d: category = %q, want %q (error: %v)", idx, r.Category, test.categories[idx], r.Err)
+				}
+				if r.Status == StatusDetected && (r.Detection == nil || r.Detection.Crop.Empty()) {
+					t.Errorf("result %d: detection = %+v, want a framed portrait", idx, r.Detection)
+				}
+				if _, err := os.Stat(r.OutputPath); r.Status == StatusCancelled && r.OutputPath != "" && err == nil {
+					t.Errorf("result %d: cancelled input wrote %s", idx, r.OutputPath)
+				}
+			}
+
+			var outputs int
+			err = filepath.WalkDir(outdir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && d.Name() != ManifestName {
+					outputs++
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if converted := report.Converted; outputs < test.outputs || outputs != converted {
+				t.Errorf("wrote %d outputs for %d converted inputs, want %d", outputs, converted, test.outputs)
+			}
+		})
+	}
+}
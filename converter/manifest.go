@@ -0,0 +1,229 @@
+package convert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// ManifestName is the name of the manifest written to the output directory by WithManifest
+const ManifestName = ".face-detect-manifest.json"
+
+// manifestEntry records how an output was produced.
+// OutputPath is relative to the output directory
+type manifestEntry struct {
+	OutputPath   string `json:"output_path"`
+	InputHash    string `json:"input_hash"`
+	SettingsHash string `json:"settings_hash"`
+	OutputHash   string `json:"output_hash"`
+}
+
+// manifest records the outputs produced for each input, keyed by absolute input path
+type manifest struct {
+	mu      sync.Mutex
+	outdir  string
+	Entries map[string]*manifestEntry `json:"entries"`
+}
+
+// loadManifest loads the manifest from outdir, returning an empty manifest if it doesn't exist
+func loadManifest(outdir string) (*manifest, error) {
+	m := &manifest{outdir: outdir, Entries: make(map[string]*manifestEntry)}
+
+	buf, err := os.ReadFile(filepath.Join(outdir, ManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	if err = json.Unmarshal(buf, m); err != nil {
+		return m, fmt.Errorf("could not parse manifest: %w", err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]*manifestEntry)
+	}
+
+	return m, nil
+}
+
+// save writes the manifest to its output directory
+func (m *manifest) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not encode manifest: %w", err)
+	}
+
+	err = writeAtomic(context.Background(), filepath.Join(m.outdir, ManifestName), func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// get returns the entry for inpath, or nil if it doesn't exist
+func (m *manifest) get(inpath string) *manifestEntry {
+	abs, err := filepath.Abs(inpath)
+	if err != nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Entries[abs]
+}
+
+// set records the output produced for inpath
+func (m *manifest) set(inpath string, entry *manifestEntry) error {
+	abs, err := filepath.Abs(inpath)
+	if err != nil {
+		return fmt.Errorf("could not resolve input path: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[abs] = entry
+	return nil
+}
+
+// ownedByOther returns true if an entry for an input other than inpath was written to the output path rel
+func (m *manifest) ownedByOther(inpath, rel string, fold bool) bool {
+	abs, err := filepath.Abs(inpath)
+	if err != nil {
+		return true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for other, entry := range m.Entries {
+		if other != abs && collisionKey(entry.OutputPath, fold) == collisionKey(rel, fold) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune removes outputs and entries for inputs that no longer exist, returning the removed output paths
+func (m *manifest) prune() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned []string
+	for inpath, entry := range m.Entries {
+		if _, err := os.Stat(inpath); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		outpath := filepath.Join(m.outdir, entry.OutputPath)
+		if err := os.Remove(outpath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("could not remove %s: %w", outpath, err)
+		}
+		delete(m.Entries, inpath)
+		pruned = append(pruned, outpath)
+	}
+
+	return pruned, nil
+}
+
+// settingsHash returns a hash of the settings that affect the output of a conversion
+func (c *config) settingsHash() (string, error) {
+	baseDir := c.baseDir
+	if baseDir != "" {
+		abs, err := filepath.Abs(baseDir)
+		if err != nil {
+			return "", fmt.Errorf("could not resolve base directory: %w", err)
+		}
+		baseDir = abs
+	}
+
+	buf, err := json.Marshal(struct {
+		PortraitConfig  *facedetect.PortraitConfig
+		NameTemplate    string
+		BaseDir         string
+		CollisionPolicy CollisionPolicy
+		UseEXIF         bool
+		Retries         []RetryStrategy
+	}{c.portraitConfig, c.nameTemplate, baseDir, c.collisionPolicy, c.useEXIF, c.retries})
+	if err != nil {
+		return "", fmt.Errorf("could not encode settings: %w", err)
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// tracked returns true if the manifest shows the existing output at r.OutputPath was produced from r's input
+func (c *config) tracked(r *Result) bool {
+	if c.manifest == nil {
+		return false
+	}
+	entry := c.manifest.get(r.InputPath)
+	return entry != nil && collisionKey(filepath.Join(c.manifest.outdir, entry.OutputPath), c.foldCase) == collisionKey(r.OutputPath, c.foldCase)
+}
+
+// unchanged returns true if the manifest shows the output for r was produced from the same input and settings,
+// and the output hasn't been modified. r.OutputPath is set to the recorded output path
+func (c *config) unchanged(r *Result, inputHash string) bool {
+	entry := c.manifest.get(r.InputPath)
+	if entry == nil || entry.InputHash != inputHash || entry.SettingsHash != c.settings {
+		return false
+	}
+
+	outpath := filepath.Join(c.manifest.outdir, entry.OutputPath)
+	if !r.pendingDimensions && collisionKey(outpath, c.foldCase) != collisionKey(r.OutputPath, c.foldCase) {
+		return false
+	}
+
+	if outputHash, err := hashFile(outpath); err != nil || outputHash != entry.OutputHash {
+		return false
+	}
+
+	r.OutputPath = outpath
+	r.pendingDimensions = false
+	return true
+}
+
+// record adds the output of r to the manifest, removing the previous output for the input if it was written to a different path
+// that no other input owns
+func (c *config) record(r *Result, inputHash string) error {
+	outputHash, err := hashFile(r.OutputPath)
+	if err != nil {
+		return fmt.Errorf("could not hash output: %w", err)
+	}
+
+	rel, err := filepath.Rel(c.manifest.outdir, r.OutputPath)
+	if err != nil {
+		return fmt.Errorf("could not resolve output path: %w", err)
+	}
+
+	// the previous output may now belong to another input, if it was renamed or inputs were reordered
+	if prev := c.manifest.get(r.InputPath); prev != nil && collisionKey(prev.OutputPath, c.foldCase) != collisionKey(rel, c.foldCase) &&
+		!c.manifest.ownedByOther(r.InputPath, prev.OutputPath, c.foldCase) && !c.plannedByOther(r, filepath.Join(c.manifest.outdir, prev.OutputPath)) {
+		if err = os.Remove(filepath.Join(c.manifest.outdir, prev.OutputPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.logger.Warn("could not remove previous output", "input_path", r.InputPath, "output_path", prev.OutputPath, "error", err)
+		}
+	}
+
+	return c.manifest.set(r.InputPath, &manifestEntry{
+		OutputPath:   rel,
+		InputHash:    inputHash,
+		SettingsHash: c.settings,
+		OutputHash:   outputHash,
+	})
+}
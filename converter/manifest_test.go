@@ -0,0 +1,222 @@
+package convert
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+	"github.com/korylprince/go-face-detect/cascade"
+)
+
+// manifestConfig returns a config with an empty manifest in a new output directory, and a new input directory
+func manifestConfig(t *testing.T) (c *config, indir, outdir string) {
+	t.Helper()
+	indir, outdir = t.TempDir(), t.TempDir()
+	m, err := loadManifest(outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &config{
+		manifest:        m,
+		settings:        "settings",
+		logger:          testLogger(),
+		nameTemplate:    DefaultNameTemplate,
+		portraitConfig:  facedetect.DefaultPortraitConfig,
+		collisionPolicy: CollisionError,
+	}
+	return c, indir, outdir
+}
+
+func TestSettingsHash(t *testing.T) {
+	base := &config{nameTemplate: DefaultNameTemplate, portraitConfig: facedetect.DefaultPortraitConfig, collisionPolicy: CollisionError}
+	baseHash, err := base.settingsHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, modify := range map[string]func(c *config){
+		"base dir":         func(c *config) { c.baseDir = "photos" },
+		"collision policy": func(c *config) { c.collisionPolicy = CollisionRename },
+		"name template":    func(c *config) { c.nameTemplate = "{index}{ext}" },
+		"EXIF":             func(c *config) { c.useEXIF = true },
+		"retries":          func(c *config) { c.retries = DefaultRetryStrategies },
+	} {
+		c := *base
+		modify(&c)
+		hash, err := c.settingsHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash == baseHash {
+			t.Errorf("changing the %s didn't change the settings hash", name)
+		}
+	}
+
+	c := *base
+	if hash, _ := c.settingsHash(); hash != baseHash {
+		t.Error("settings hash isn't deterministic")
+	}
+}
+
+func TestManifestUnchanged(t *testing.T) {
+	c, indir, outdir := manifestConfig(t)
+	inpath, outpath := filepath.Join(indir, "jdoe.jpg"), filepath.Join(outdir, "jdoe.jpg")
+	writeFile(t, inpath, "input")
+	writeFile(t, outpath, "output")
+
+	r := &Result{InputPath: inpath, OutputPath: outpath}
+	if c.unchanged(r, "hash") {
+		t.Fatal("unrecorded input is unchanged")
+	}
+	if err := c.record(r, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.tracked(r) {
+		t.Error("recorded output isn't tracked")
+	}
+
+	tests := []struct {
+		name      string
+		inputHash string
+		settings  string
+		outpath   string
+		want      bool
+	}{
+		{"unchanged", "hash", "settings", outpath, true},
+		{"input changed", "other", "settings", outpath, false},
+		{"settings changed", "hash", "other", outpath, false},
+		{"output path changed", "hash", "settings", filepath.Join(outdir, "other.jpg"), false},
+	}
+	for _, test := range tests {
+		c.settings = test.settings
+		if got := c.unchanged(&Result{InputPath: inpath, OutputPath: test.outpath}, test.inputHash); got != test.want {
+			t.Errorf("%s: unchanged = %t, want %t", test.name, got, test.want)
+		}
+	}
+	c.settings = "settings"
+
+	// pending dimensions use the recorded output path
+	pending := &Result{InputPath: inpath, OutputPath: filepath.Join(outdir, "jdoe-{width}.jpg"), pendingDimensions: true}
+	if !c.unchanged(pending, "hash") || pending.OutputPath != outpath || pending.pendingDimensions {
+		t.Errorf("pending dimensions: unchanged result = %+v", pending)
+	}
+
+	writeFile(t, outpath, "modified")
+	if c.unchanged(&Result{InputPath: inpath, OutputPath: outpath}, "hash") {
+		t.Error("modified output is unchanged")
+	}
+}
+
+func TestManifestRecordRemovesPrevious(t *testing.T) {
+	c, indir, outdir := manifestConfig(t)
+	inpath, other := filepath.Join(indir, "jdoe.jpg"), filepath.Join(indir, "asmith.jpg")
+	oldpath, newpath := filepath.Join(outdir, "old.jpg"), filepath.Join(outdir, "new.jpg")
+
+	tests := []struct {
+		name    string
+		setup   func()
+		removed bool
+	}{
+		{"removed", func() {}, true},
+		{"owned by another input in the manifest", func() {
+			writeFile(t, other, "input")
+			r := &Result{InputPath: other, OutputPath: oldpath}
+			if err := c.record(r, "hash"); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"planned for another input", func() {
+			c.planned = map[string]*Result{collisionKey(oldpath, c.foldCase): {InputPath: other, OutputPath: oldpath}}
+		}, false},
+	}
+
+	for _, test := range tests {
+		c.manifest.Entries = make(map[string]*manifestEntry)
+		c.planned = nil
+		writeFile(t, inpath, "input")
+		writeFile(t, oldpath, "old output")
+		if err := c.record(&Result{InputPath: inpath, OutputPath: oldpath}, "hash"); err != nil {
+			t.Fatal(err)
+		}
+
+		test.setup()
+		writeFile(t, newpath, "new output")
+		if err := c.record(&Result{InputPath: inpath, OutputPath: newpath}, "hash"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := os.Stat(oldpath)
+		if removed := errors.Is(err, os.ErrNotExist); removed != test.removed {
+			t.Errorf("%s: previous output removed = %t, want %t", test.name, removed, test.removed)
+		}
+	}
+}
+
+func TestManifestPrune(t *testing.T) {
+	c, indir, outdir := manifestConfig(t)
+	kept, deleted := filepath.Join(indir, "jdoe.jpg"), filepath.Join(indir, "asmith.jpg")
+	for _, inpath := range []string{kept, deleted} {
+		writeFile(t, inpath, "input")
+		outpath := filepath.Join(outdir, filepath.Base(inpath))
+		writeFile(t, outpath, "output")
+		if err := c.record(&Result{InputPath: inpath, OutputPath: outpath}, "hash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.manifest.save(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 2 {
+		t.Fatalf("loaded %d entries, want 2", len(m.Entries))
+	}
+
+	pruned, err := m.prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outdir, "asmith.jpg"); len(pruned) != 1 || pruned[0] != want {
+		t.Errorf("pruned = %v, want [%s]", pruned, want)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "asmith.jpg")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("pruned output wasn't removed")
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "jdoe.jpg")); err != nil {
+		t.Errorf("kept output was removed: %v", err)
+	}
+	if m.get(kept) == nil || m.get(deleted) != nil {
+		t.Error("pruned the wrong manifest entries")
+	}
+}
+
+func TestManifestOverwrite(t *testing.T) {
+	infiles := writeFixtures(t, t.TempDir(), []string{"face.png"})
+	outdir := t.TempDir()
+	for _, test := range []struct {
+		name      string
+		overwrite bool
+		want      Status
+	}{
+		{"first run", false, StatusConverted},
+		{"unchanged", false, StatusUnchanged},
+		{"overwrite", true, StatusConverted},
+	} {
+		report, err := ConvertPortraits(cascade.Detector, infiles, outdir,
+			WithLogger(testLogger()), WithManifest(true), WithOverwrite(test.overwrite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := report.Results[0]; r.Status != test.want {
+			t.Errorf("%s: status = %q, want %q (error: %v)", test.name, r.Status, test.want, r.Err)
+		}
+	}
+}
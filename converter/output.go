@@ -0,0 +1,239 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/exp/slog"
+)
+
+// CollisionPolicy determines what happens when multiple inputs would be written to the same output path
+type CollisionPolicy string
+
+const (
+	// CollisionError fails every input that would be written to the same output path
+	CollisionError CollisionPolicy = "error"
+	// CollisionRename appends a numeric suffix (e.g. jdoe-2.jpg) to the output path of every colliding input after the first
+	CollisionRename CollisionPolicy = "rename"
+)
+
+var ErrOutputCollision = errors.New("output path collides with another input")
+
+// matchAny returns true if name or its base name matches any of the glob patterns
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		for _, n := range []string{name, filepath.Base(name)} {
+			matched, err := filepath.Match(pattern, n)
+			if err != nil {
+				return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isAuxiliary returns true if path is the sidecar, quarantine report, or quarantine debug image of an existing file
+func isAuxiliary(path string) bool {
+	for _, ext := range []string{SidecarExt, QuarantineReportExt, QuarantineDebugExt} {
+		if !strings.HasSuffix(path, ext) {
+			continue
+		}
+		if info, err := os.Stat(strings.TrimSuffix(path, ext)); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandInputs returns the files given in paths, recursively walking directories.
+// Sidecars (see WithSidecars), quarantine reports, and quarantine debug images (see WithQuarantine) of other files found in directories are skipped.
+// Files found in directories are included if they match any include glob (or include is empty) and don't match any exclude glob.
+// Globs are matched against both the path relative to the walked directory and the base name, using filepath.Match.
+// Files given directly in paths are always included. Entries in directories that can't be read are logged with logger and skipped
+func ExpandInputs(paths, include, exclude []string, logger *slog.Logger) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				logger.Warn("could not read input; skipping", "path", p, "error", err)
+				return nil
+			}
+			if !d.Type().IsRegular() || isAuxiliary(p) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			if len(include) > 0 {
+				if matched, err := matchAny(include, rel); err != nil || !matched {
+					return err
+				}
+			}
+			if matched, err := matchAny(exclude, rel); err != nil || matched {
+				return err
+			}
+
+			files = append(files, p)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not walk %s: %w", path, err)
+		}
+	}
+
+	return files, nil
+}
+
+// mirrorPath returns name, preceded by the directory of inpath relative to c.baseDir if set
+func (c *config) mirrorPath(inpath, name string) (string, error) {
+	if c.baseDir == "" {
+		return name, nil
+	}
+
+	base, err := filepath.Abs(c.baseDir)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve base directory: %w", err)
+	}
+	abs, err := filepath.Abs(inpath)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve input path: %w", err)
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("input is not inside base directory %s", c.baseDir)
+	}
+
+	return filepath.Join(filepath.Dir(rel), name), nil
+}
+
+// outputPath returns the output path for the input at inpath and index, named with c.nameTemplate.
+// If c.baseDir is set, the directory of inpath relative to it is preserved under outdir
+func (c *config) outputPath(outdir, inpath string, index int) (string, error) {
+	name, err := c.outputName(inpath, index)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := c.mirrorPath(inpath, name)
+	if err != nil {
+		return "", err
+	}
+
+	return c.portraitConfig.OutputPath(filepath.Join(outdir, rel)), nil
+}
+
+// swapCase returns s with the case of each letter swapped
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// caseInsensitive returns true if the filesystem containing dir ignores case in file names.
+// It checks whether the nearest existing ancestor of dir with letters in its name can be found with its case swapped,
+// so nothing is written
+func caseInsensitive(dir string) bool {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	for {
+		base := filepath.Base(path)
+		if swapped := swapCase(base); swapped != base {
+			if info, err := os.Stat(path); err == nil {
+				other, err := os.Stat(filepath.Join(filepath.Dir(path), swapped))
+				return err == nil && os.SameFile(info, other)
+			}
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// collisionKey returns the key used to detect output collisions, ignoring case if fold is set
+func collisionKey(path string, fold bool) string {
+	path = filepath.Clean(path)
+	if fold {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// planOutputs returns a Result for each input with its output path set.
+// Output paths containing {width} or {height} are expanded after conversion.
+// Inputs whose output path can't be determined are marked failed.
+// Output paths that differ only by case collide if c.foldCase is set. The planned output paths are recorded in c.planned
+func (c *config) planOutputs(outdir string, infiles []string) []*Result {
+	results := make([]*Result, len(infiles))
+	claimed := make(map[string][]*Result)
+	for idx, inpath := range infiles {
+		r := &Result{InputPath: inpath}
+		results[idx] = r
+
+		outpath, err := c.outputPath(outdir, inpath, idx)
+		if err != nil {
+			r.Status, r.Category, r.Err = StatusFailed, CategoryOutputPath, err
+			continue
+		}
+		r.OutputPath = outpath
+
+		key := collisionKey(outpath, c.foldCase)
+		if len(claimed[key]) > 0 && c.collisionPolicy == CollisionRename {
+			ext := filepath.Ext(outpath)
+			stem := outpath[:len(outpath)-len(ext)]
+			for n := 2; len(claimed[key]) > 0; n++ {
+				r.OutputPath = fmt.Sprintf("%s-%d%s", stem, n, ext)
+				key = collisionKey(r.OutputPath, c.foldCase)
+			}
+		}
+		claimed[key] = append(claimed[key], r)
+		r.pendingDimensions = hasDimensions(r.OutputPath)
+	}
+
+	c.planned = make(map[string]*Result)
+	for key, rs := range claimed {
+		if len(rs) < 2 {
+			c.planned[key] = rs[0]
+			continue
+		}
+		for _, r := range rs {
+			r.Status, r.Category = StatusFailed, CategoryOutputPath
+			r.Err = fmt.Errorf("%w: %s", ErrOutputCollision, r.OutputPath)
+		}
+	}
+
+	return results
+}
+
+// plannedByOther returns true if outpath is the planned output path of an input other than r's
+func (c *config) plannedByOther(r *Result, outpath string) bool {
+	other, ok := c.planned[collisionKey(outpath, c.foldCase)]
+	return ok && other != r
+}
@@ -0,0 +1,175 @@
+package convert
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+func TestPlanOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   CollisionPolicy
+		baseDir  string
+		foldCase bool
+		infiles  []string
+		outputs  []string
+		failed   []bool
+	}{
+		{
+			name:    "distinct",
+			policy:  CollisionError,
+			infiles: []string{"a/jdoe.jpg", "b/asmith.jpg"},
+			outputs: []string{"out/jdoe.jpg", "out/asmith.jpg"},
+			failed:  []bool{false, false},
+		},
+		{
+			name:    "error",
+			policy:  CollisionError,
+			infiles: []string{"a/jdoe.jpg", "b/jdoe.jpg", "c/asmith.jpg"},
+			outputs: []string{"out/jdoe.jpg", "out/jdoe.jpg", "out/asmith.jpg"},
+			failed:  []bool{true, true, false},
+		},
+		{
+			name:    "rename",
+			policy:  CollisionRename,
+			infiles: []string{"a/jdoe.jpg", "b/jdoe.jpg", "c/jdoe.jpg"},
+			outputs: []string{"out/jdoe.jpg", "out/jdoe-2.jpg", "out/jdoe-3.jpg"},
+			failed:  []bool{false, false, false},
+		},
+		{
+			name:    "rename skips claimed suffix",
+			policy:  CollisionRename,
+			infiles: []string{"a/jdoe.jpg", "a/jdoe-2.jpg", "b/jdoe.jpg"},
+			outputs: []string{"out/jdoe.jpg", "out/jdoe-2.jpg", "out/jdoe-3.jpg"},
+			failed:  []bool{false, false, false},
+		},
+		{
+			name:    "case sensitive",
+			policy:  CollisionError,
+			infiles: []string{"a/JDoe.jpg", "b/jdoe.jpg"},
+			outputs: []string{"out/JDoe.jpg", "out/jdoe.jpg"},
+			failed:  []bool{false, false},
+		},
+		{
+			name:     "case insensitive",
+			policy:   CollisionError,
+			foldCase: true,
+			infiles:  []string{"a/JDoe.jpg", "b/jdoe.jpg"},
+			outputs:  []string{"out/JDoe.jpg", "out/jdoe.jpg"},
+			failed:   []bool{true, true},
+		},
+		{
+			name:    "base dir",
+			policy:  CollisionError,
+			baseDir: "in",
+			infiles: []string{"in/a/jdoe.jpg", "in/b/jdoe.jpg", "other/jdoe.jpg"},
+			outputs: []string{"out/a/jdoe.jpg", "out/b/jdoe.jpg", ""},
+			failed:  []bool{false, false, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &config{
+				nameTemplate:    DefaultNameTemplate,
+				portraitConfig:  facedetect.DefaultPortraitConfig,
+				collisionPolicy: test.policy,
+				baseDir:         test.baseDir,
+				foldCase:        test.foldCase,
+			}
+			results := c.planOutputs("out", test.infiles)
+			if len(results) != len(test.infiles) {
+				t.Fatalf("got %d results, want %d", len(results), len(test.infiles))
+			}
+			for idx, r := range results {
+				if r.InputPath != test.infiles[idx] {
+					t.Errorf("result %d: input path = %q, want %q", idx, r.InputPath, test.infiles[idx])
+				}
+				if r.OutputPath != filepath.FromSlash(test.outputs[idx]) {
+					t.Errorf("result %d: output path = %q, want %q", idx, r.OutputPath, test.outputs[idx])
+				}
+				if failed := r.Status == StatusFailed; failed != test.failed[idx] {
+					t.Errorf("result %d: failed = %t, want %t (error: %v)", idx, failed, test.failed[idx], r.Err)
+				}
+				if r.Status == StatusFailed && r.Category != CategoryOutputPath {
+					t.Errorf("result %d: category = %q, want %q", idx, r.Category, CategoryOutputPath)
+				}
+				if r.Status == StatusFailed && r.OutputPath != "" && !errors.Is(r.Err, ErrOutputCollision) {
+					t.Errorf("result %d: error = %v, want %v", idx, r.Err, ErrOutputCollision)
+				}
+			}
+		})
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Case")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(dir), "cASE"))
+	want := err == nil
+	if got := caseInsensitive(filepath.Join(dir, "missing", "out")); got != want {
+		t.Errorf("caseInsensitive = %t, want %t", got, want)
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.png", "a.jpg.json", "a.jpg.quarantine.json", "a.jpg.debug.png", "sub/c.jpg", "sub/notes.txt", "orphan.json", "orphan.debug.png"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ExpandInputs([]string{dir}, nil, []string{"*.txt"}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.jpg", "b.png", "orphan.debug.png", "orphan.json", "sub/c.jpg"}
+	if len(files) != len(want) {
+		t.Fatalf("got %v, want %v", files, want)
+	}
+	for idx, f := range files {
+		if f != filepath.Join(dir, filepath.FromSlash(want[idx])) {
+			t.Errorf("file %d = %q, want %q", idx, f, want[idx])
+		}
+	}
+}
+
+func TestExpandInputsUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+
+	dir := t.TempDir()
+	locked := filepath.Join(dir, "locked")
+	if err := os.Mkdir(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	files, err := ExpandInputs([]string{dir}, nil, nil, testLogger())
+	if err != nil {
+		t.Fatalf("unreadable directory wasn't skipped: %v", err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(dir, "a.jpg") {
+		t.Errorf("got %v, want [a.jpg]", files)
+	}
+}
@@ -0,0 +1,294 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// job is an input moving through the conversion pipeline.
+// img is set by the decode stage and portrait by the detect stage, and each is released by the following stage
+type job struct {
+	r         *Result
+	start     time.Time
+	inputHash string
+	config    *facedetect.PortraitConfig
+	hints     *facedetect.Hints
+	img       *image.NRGBA
+	portrait  *image.NRGBA
+	// cost is the memory acquired from the converter's budget for the job
+	cost int64
+}
+
+// stage is a step of the conversion pipeline, run by its own pool of workers.
+// run returns an error if the job failed or was skipped. If run sets the job's status without an error,
+// the job is finished; otherwise it moves on to the next stage
+type stage struct {
+	name    string
+	workers int
+	run     func(ctx context.Context, c *config, j *job) error
+}
+
+// decodeStage checks whether the input needs converting, then reads its sidecar and decodes it
+func decodeStage(ctx context.Context, c *config, j *job) error {
+	r := j.r
+	if c.manifest != nil {
+		hash, err := c.hashInput(r)
+		if err != nil {
+			r.Category = CategoryDecode
+			return err
+		}
+		j.inputHash = hash
+
+		if !c.overwrite && c.unchanged(r, hash) {
+			c.logger.Debug("input and settings unchanged", "input_path", r.InputPath, "output_path", r.OutputPath)
+			r.Status = StatusUnchanged
+			return nil
+		}
+	}
+
+	if !c.dryRun && !r.pendingDimensions && c.skipExisting(r) {
+		return errSkipped
+	}
+
+	j.config = c.portraitConfig
+	if c.sidecars {
+		s, err := readSidecar(r.InputPath)
+		if err != nil {
+			r.Category = CategorySidecar
+			return err
+		}
+		if s != nil {
+			if j.config, err = s.portraitConfig(j.config); err != nil {
+				r.Category = CategorySidecar
+				return err
+			}
+			j.hints = s.hints()
+			c.logger.Debug("applying sidecar", "input_path", r.InputPath, "sidecar_path", r.InputPath+SidecarExt)
+		}
+	}
+
+	if err := c.admit(ctx, j); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	img, err := c.decode(r)
+	r.Timings.Decode = time.Since(start)
+	if err != nil {
+		r.Category = CategoryDecode
+		return err
+	}
+	j.img = img
+
+	return nil
+}
+
+// corrected returns true if hints position the face or eyes, or set the rotation
+func corrected(hints *facedetect.Hints) bool {
+	return hints != nil && (hints.Located() || hints.Rotation != nil)
+}
+
+// detectStage frames the portrait, retrying with c.retries if detection fails, then renders it.
+// Dry runs finish after framing
+func detectStage(ctx context.Context, c *config, j *job) error {
+	r := j.r
+	img := j.img
+	j.img = nil
+
+	start := time.Now()
+	f, err := c.detector.FrameWithHints(img, j.config, j.hints)
+	r.Detection = newDetection(f)
+	// sidecar corrections are in the coordinates of the original input, so they can't be retried
+	if err != nil && !corrected(j.hints) && len(c.retries) > 0 {
+		if retried, detection := c.retryFrame(r, img, j.config); retried != nil {
+			f, r.Detection, err = retried, detection, nil
+		}
+	}
+	r.Timings.Detect = time.Since(start)
+	if err != nil {
+		r.Category = categorizePortraitError(err)
+		return err
+	}
+
+	if c.dryRun {
+		r.Status = StatusDetected
+		c.logger.Info("portrait framed", "input_path", r.InputPath, "faces", r.Detection.Faces,
+			"width", r.Detection.Crop.Dx(), "height", r.Detection.Crop.Dy(), "angle", r.Detection.Angle)
+		return nil
+	}
+
+	start = time.Now()
+	j.portrait = f.Render(j.config)
+	r.Timings.Render = time.Since(start)
+
+	return nil
+}
+
+// encodeStage encodes the portrait, resolves the final output path, then writes it
+func encodeStage(ctx context.Context, c *config, j *job) error {
+	r := j.r
+	portrait := j.portrait
+	j.portrait = nil
+
+	// sidecar overrides can change the output format
+	if outpath := j.config.OutputPath(r.OutputPath); outpath != r.OutputPath {
+		r.OutputPath = outpath
+		if !r.pendingDimensions && c.skipExisting(r) {
+			return errSkipped
+		}
+	}
+
+	format, err := j.config.OutputFormat(r.OutputPath)
+	if err != nil {
+		r.Category = CategoryWrite
+		return fmt.Errorf("could not write portrait: %w", err)
+	}
+
+	// encode before naming the output, since fitting a maximum file size can downscale the portrait
+	start := time.Now()
+	buf := new(bytes.Buffer)
+	res, err := j.config.Encode(buf, portrait, format)
+	if err != nil {
+		r.Timings.Encode = time.Since(start)
+		r.Category = CategoryWrite
+		if errors.Is(err, facedetect.ErrFileSizeExceeded) {
+			r.Category = CategoryFileSize
+		}
+		return fmt.Errorf("could not encode portrait: %w", err)
+	}
+
+	if r.pendingDimensions {
+		r.OutputPath = expandDimensions(r.OutputPath, res.Width, res.Height)
+		r.pendingDimensions = false
+		if c.skipExisting(r) {
+			return errSkipped
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(r.OutputPath), 0755); err != nil {
+		r.Category = CategoryWrite
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	err = writeAtomic(ctx, r.OutputPath, func(w io.Writer) error {
+		_, err := buf.WriteTo(w)
+		return err
+	})
+	r.Timings.Encode = time.Since(start)
+	if err != nil {
+		r.Category = CategoryWrite
+		return fmt.Errorf("could not write portrait: %w", err)
+	}
+	r.Quality, r.Size = res.Quality, res.Size
+
+	r.Status = StatusConverted
+	c.logger.Info("portrait converted", "input_path", r.InputPath, "output_path", r.OutputPath, "size", r.Size, "quality", r.Quality)
+
+	if c.manifest != nil {
+		if err := c.record(r, j.inputHash); err != nil {
+			c.logger.Warn("could not record output in manifest", "input_path", r.InputPath, "output_path", r.OutputPath, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// settle sets the status of r from err returned by a stage
+func (c *config) settle(ctx context.Context, r *Result, err error) {
+	switch {
+	case errors.Is(err, errSkipped):
+		r.Status = StatusSkipped
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		r.Status, r.Category, r.Err = StatusCancelled, CategoryNone, err
+		c.logger.Warn("conversion cancelled", "input_path", r.InputPath, "output_path", r.OutputPath)
+	case c.dryRun:
+		r.Status, r.Err = StatusFailed, err
+		c.logger.Error("detection failed", "input_path", r.InputPath, "category", r.Category, "error", err)
+	default:
+		r.Status, r.Err = StatusFailed, err
+		c.logger.Error("conversion failed", "input_path", r.InputPath, "output_path", r.OutputPath, "category", r.Category, "error", err)
+	}
+}
+
+// runJob runs s on j, returning true if j should move on to the next stage
+func (c *config) runJob(ctx context.Context, s *stage, j *job) (next bool) {
+	r := j.r
+
+	// recover panics from malformed images so the rest of the batch can continue
+	defer func() {
+		if v := recover(); v != nil {
+			j.img, j.portrait = nil, nil
+			r.Status, r.Category, r.Err = StatusFailed, CategoryPanic, fmt.Errorf("%w: %v", ErrPanic, v)
+			c.logger.Error("conversion failed", "input_path", r.InputPath, "output_path", r.OutputPath, "category", r.Category, "error", r.Err)
+			c.logger.Debug("panic stack trace", "input_path", r.InputPath, "stage", s.name, "stack", string(debug.Stack()))
+			next = false
+		}
+	}()
+
+	// queued jobs are cancelled without running the stage after a failure when failing fast
+	if stopped(ctx, c.stop) {
+		r.Status, r.Err = StatusCancelled, ctx.Err()
+		return false
+	}
+
+	if err := s.run(ctx, c, j); err != nil {
+		c.settle(ctx, r, err)
+		return false
+	}
+
+	return r.Status == ""
+}
+
+// runPipeline runs jobs from in through each of stages until in is closed and every job is finished.
+// Each stage runs in its own pool of workers, and stages are connected by queues holding up to c.queueSize jobs.
+// complete is called with each job when it's finished
+func (c *config) runPipeline(ctx context.Context, stages []*stage, in <-chan *job, complete func(*job)) {
+	for idx, s := range stages {
+		var out chan *job
+		if idx < len(stages)-1 {
+			out = make(chan *job, c.queueSize)
+		}
+
+		wg := new(sync.WaitGroup)
+		wg.Add(s.workers)
+		for i := 0; i < s.workers; i++ {
+			go func(s *stage, in <-chan *job, first bool) {
+				defer wg.Done()
+				for j := range in {
+					if first {
+						j.start = time.Now()
+						c.progress.send(EventStarted, j.r)
+					}
+					if c.runJob(ctx, s, j) && out != nil {
+						out <- j
+						continue
+					}
+					complete(j)
+				}
+			}(s, in, idx == 0)
+		}
+
+		if out == nil {
+			wg.Wait()
+			return
+		}
+
+		// close the queue once every worker of the stage is done
+		go func(wg *sync.WaitGroup, out chan *job) {
+			wg.Wait()
+			close(out)
+		}(wg, out)
+		in = out
+	}
+}
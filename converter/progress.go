@@ -0,0 +1,88 @@
+package convert
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of a Progress event
+type EventType string
+
+const (
+	// EventStarted is sent when an input starts converting
+	EventStarted EventType = "started"
+	// EventFinished is sent when an input finishes without failing, including skipped and cancelled inputs
+	EventFinished EventType = "finished"
+	// EventFailed is sent when an input fails
+	EventFailed EventType = "failed"
+)
+
+// Progress is a progress event sent by WithProgress.
+// Result is the input the event is for and must not be modified.
+// Completed is the number of inputs that have finished or failed, out of Total.
+// ETA is the estimated time remaining, or 0 if no inputs have completed
+type Progress struct {
+	Event     EventType
+	Result    *Result
+	Total     int
+	Completed int
+	Failed    int
+	Elapsed   time.Duration
+	ETA       time.Duration
+}
+
+// progressTracker counts completed inputs and sends Progress events to fn
+type progressTracker struct {
+	mu        sync.Mutex
+	fn        func(Progress)
+	start     time.Time
+	total     int
+	completed int
+	failed    int
+}
+
+func newProgressTracker(fn func(Progress), total int) *progressTracker {
+	return &progressTracker{fn: fn, start: time.Now(), total: total}
+}
+
+// send sends an event for r to the tracker's callback, counting r as completed if event isn't EventStarted.
+// Events are sent one at a time
+func (t *progressTracker) send(event EventType, r *Result) {
+	if t.fn == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch event {
+	case EventFinished:
+		t.completed++
+	case EventFailed:
+		t.completed++
+		t.failed++
+	}
+
+	p := Progress{
+		Event:     event,
+		Result:    r,
+		Total:     t.total,
+		Completed: t.completed,
+		Failed:    t.failed,
+		Elapsed:   time.Since(t.start),
+	}
+	if t.completed > 0 {
+		p.ETA = p.Elapsed / time.Duration(t.completed) * time.Duration(t.total-t.completed)
+	}
+
+	t.fn(p)
+}
+
+// done sends EventFinished or EventFailed for r depending on its status
+func (t *progressTracker) done(r *Result) {
+	if r.Status == StatusFailed {
+		t.send(EventFailed, r)
+		return
+	}
+	t.send(EventFinished, r)
+}
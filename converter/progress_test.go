@@ -0,0 +1,31 @@
+package convert
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProgressCompletesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var events []Progress
+	infiles := []string{"a.jpg", "b.jpg", "c.jpg"}
+	report, err := ConvertPortraitsContext(ctx, nil, infiles, t.TempDir(),
+		WithLogger(testLogger()),
+		WithProgress(func(p Progress) { events = append(events, p) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Cancelled != len(infiles) {
+		t.Errorf("cancelled = %d, want %d", report.Cancelled, len(infiles))
+	}
+	if len(events) == 0 {
+		t.Fatal("no progress events sent")
+	}
+	if last := events[len(events)-1]; last.Completed != last.Total || last.Total != len(infiles) {
+		t.Errorf("last progress event completed %d of %d, want %d of %d", last.Completed, last.Total, len(infiles), len(infiles))
+	}
+}
@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+const (
+	// QuarantineReportExt is appended to a quarantined input's path to name its JSON report, e.g. photo.jpg.quarantine.json.
+	// It differs from SidecarExt so quarantined inputs can be corrected and converted again
+	QuarantineReportExt = ".quarantine.json"
+	// QuarantineDebugExt is appended to a quarantined input's path to name its annotated debug image, e.g. photo.jpg.debug.png
+	QuarantineDebugExt = ".debug.png"
+)
+
+// quarantineReport is the JSON report written next to quarantined inputs.
+// Diagnosis is nil if the input couldn't be decoded
+type quarantineReport struct {
+	InputPath  string                `json:"input_path"`
+	OutputPath string                `json:"output_path"`
+	Category   ErrorCategory         `json:"category"`
+	Error      string                `json:"error"`
+	Diagnosis  *facedetect.Diagnosis `json:"diagnosis"`
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer in.Close()
+
+	return writeAtomic(context.Background(), dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// planQuarantine sets the path each input in results is copied to if it's quarantined.
+// Inputs with the same name are given a numeric suffix (e.g. jdoe-2.jpg) in input order
+func (c *config) planQuarantine(results []*Result) {
+	fold := caseInsensitive(c.quarantineDir)
+	c.quarantinePaths = make(map[*Result]string)
+	claimed := make(map[string]bool)
+	for _, r := range results {
+		rel, err := c.mirrorPath(r.InputPath, filepath.Base(r.InputPath))
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.quarantineDir, rel)
+
+		ext := filepath.Ext(path)
+		stem := path[:len(path)-len(ext)]
+		for n := 2; claimed[collisionKey(path, fold)]; n++ {
+			path = fmt.Sprintf("%s-%d%s", stem, n, ext)
+		}
+		claimed[collisionKey(path, fold)] = true
+		c.quarantinePaths[r] = path
+	}
+}
+
+// quarantine copies the input of the failed r to its path planned by planQuarantine with a JSON report describing the failure.
+// If the input can be decoded, faces and pupils are detected and an annotated debug image is written
+func (c *config) quarantine(r *Result) error {
+	path, ok := c.quarantinePaths[r]
+	if !ok {
+		return errors.New("input is not inside base directory")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create quarantine directory: %w", err)
+	}
+
+	if err := copyFile(r.InputPath, path); err != nil {
+		return fmt.Errorf("could not copy input: %w", err)
+	}
+
+	report := &quarantineReport{
+		InputPath:  r.InputPath,
+		OutputPath: r.OutputPath,
+		Category:   r.Category,
+		Error:      r.Err.Error(),
+	}
+
+	// undecodable inputs can't be diagnosed, and diagnosing inputs that panicked would likely panic again
+	if r.Category != CategoryDecode && r.Category != CategoryPanic {
+		if img, err := c.decode(r); err == nil {
+			report.Diagnosis = c.detector.Diagnose(img)
+			err = writeAtomic(context.Background(), path+QuarantineDebugExt, func(w io.Writer) error {
+				return imaging.Encode(w, report.Diagnosis.Annotate(img), imaging.PNG)
+			})
+			if err != nil {
+				return fmt.Errorf("could not write debug image: %w", err)
+			}
+		}
+	}
+
+	buf, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not encode report: %w", err)
+	}
+	err = writeAtomic(context.Background(), path+QuarantineReportExt, func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+
+	c.logger.Debug("input quarantined", "input_path", r.InputPath, "quarantine_path", path)
+	return nil
+}
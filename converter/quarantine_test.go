@@ -0,0 +1,103 @@
+package convert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanQuarantine(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseDir string
+		infiles []string
+		paths   []string
+	}{
+		{
+			name:    "flat",
+			infiles: []string{"a/jdoe.jpg", "b/jdoe.jpg", "c/asmith.jpg", "d/jdoe.jpg"},
+			paths:   []string{"q/jdoe.jpg", "q/jdoe-2.jpg", "q/asmith.jpg", "q/jdoe-3.jpg"},
+		},
+		{
+			name:    "base dir",
+			baseDir: "in",
+			infiles: []string{"in/a/jdoe.jpg", "in/b/jdoe.jpg", "other/jdoe.jpg"},
+			paths:   []string{"q/a/jdoe.jpg", "q/b/jdoe.jpg", ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &config{quarantineDir: "q", baseDir: test.baseDir}
+			results := make([]*Result, len(test.infiles))
+			for idx, inpath := range test.infiles {
+				results[idx] = &Result{InputPath: inpath}
+			}
+			c.planQuarantine(results)
+
+			for idx, r := range results {
+				if got := c.quarantinePaths[r]; got != filepath.FromSlash(test.paths[idx]) {
+					t.Errorf("%s: quarantine path = %q, want %q", r.InputPath, got, test.paths[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestQuarantineCollision(t *testing.T) {
+	indir, qdir := t.TempDir(), t.TempDir()
+	infiles := []string{filepath.Join(indir, "a", "jdoe.jpg"), filepath.Join(indir, "b", "jdoe.jpg")}
+	for _, inpath := range infiles {
+		writeFile(t, inpath, "not an image from "+inpath)
+	}
+
+	report, err := ConvertPortraitsContext(context.Background(), nil, infiles, t.TempDir(),
+		WithLogger(testLogger()), WithQuarantine(qdir), WithCollisionPolicy(CollisionRename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 2 {
+		t.Fatalf("failed = %d, want 2", report.Failed)
+	}
+
+	for idx, name := range []string{"jdoe.jpg", "jdoe-2.jpg"} {
+		buf, err := os.ReadFile(filepath.Join(qdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "not an image from " + infiles[idx]; string(buf) != want {
+			t.Errorf("%s = %q, want %q", name, buf, want)
+		}
+	}
+}
+
+func TestQuarantineRerun(t *testing.T) {
+	indir, qdir := t.TempDir(), t.TempDir()
+	inpath := filepath.Join(indir, "jdoe.jpg")
+	writeFile(t, inpath, "not an image")
+
+	if _, err := ConvertPortraitsContext(context.Background(), nil, []string{inpath}, t.TempDir(),
+		WithLogger(testLogger()), WithQuarantine(qdir)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(qdir, "jdoe.jpg"+QuarantineReportExt)); err != nil {
+		t.Fatalf("report wasn't written: %v", err)
+	}
+
+	infiles, err := ExpandInputs([]string{qdir}, nil, nil, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infiles) != 1 || infiles[0] != filepath.Join(qdir, "jdoe.jpg") {
+		t.Fatalf("inputs = %v, want only the quarantined input", infiles)
+	}
+
+	report, err := ConvertPortraitsContext(context.Background(), nil, infiles, t.TempDir(), WithLogger(testLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := report.Results[0]; r.Category != CategoryDecode {
+		t.Errorf("category = %q, want %q (error: %v)", r.Category, CategoryDecode, r.Err)
+	}
+}
@@ -0,0 +1,137 @@
+package convert
+
+import (
+	"errors"
+	"image"
+	"time"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// Status is the outcome of converting a single input
+type Status string
+
+const (
+	StatusConverted Status = "converted"
+	StatusSkipped   Status = "skipped-existing"
+	StatusUnchanged Status = "skipped-unchanged"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	// StatusDetected is the status of inputs whose portrait was framed by a dry run
+	StatusDetected Status = "detected"
+)
+
+// ErrorCategory classifies why a conversion failed
+type ErrorCategory string
+
+const (
+	CategoryNone             ErrorCategory = ""
+	CategoryDecode           ErrorCategory = "decode"
+	CategoryFaceUndetected   ErrorCategory = "face-undetected"
+	CategoryPupilsUndetected ErrorCategory = "pupils-undetected"
+	CategoryWrite            ErrorCategory = "write"
+	CategoryOutputPath       ErrorCategory = "output-path"
+	CategoryFileSize         ErrorCategory = "file-size"
+	CategoryPanic            ErrorCategory = "panic"
+	CategorySidecar          ErrorCategory = "sidecar"
+)
+
+// categorizePortraitError returns the category of an error returned by facedetect.Detector.Portrait
+func categorizePortraitError(err error) ErrorCategory {
+	if errors.Is(err, facedetect.ErrPupilsUndetected) {
+		return CategoryPupilsUndetected
+	}
+	if errors.Is(err, facedetect.ErrInvalidFace) {
+		return CategorySidecar
+	}
+	return CategoryFaceUndetected
+}
+
+// Detection describes what was detected in an input and how its portrait was framed.
+// Faces is the number of faces detected, and Face is the chosen face, or nil if no face was detected.
+// Angle is the counter-clockwise rotation in degrees applied to level the pupils.
+// Crop is the bounds of the portrait in the rotated input. Unless the portrait was rendered from a copy upscaled by RetryUpscale,
+// its size is the size of the portrait before any downscaling
+type Detection struct {
+	Faces          int
+	Face           *facedetect.Face
+	PupilsDetected bool
+	Angle          float64
+	Crop           image.Rectangle
+}
+
+// newDetection returns the Detection for f
+func newDetection(f *facedetect.Framing) *Detection {
+	d := &Detection{Faces: len(f.Faces), Face: f.Face, Angle: f.Angle, Crop: f.Crop}
+	if f.Face != nil {
+		d.PupilsDetected = f.Face.PupilsDetected()
+	}
+	return d
+}
+
+// Timings is the time spent in each stage of converting an input.
+// Encode includes writing the output
+type Timings struct {
+	Decode time.Duration
+	Detect time.Duration
+	Render time.Duration
+	Encode time.Duration
+}
+
+// Result is the result of converting a single input.
+// Detection is set if the input was decoded. Strategy is the retry strategy that framed the input, if any,
+// Detection is in the coordinates of the decoded input even if the strategy framed a rotated or upscaled copy of it,
+// except for RetryOrient, whose Detection is in the coordinates of the input with its EXIF orientation applied.
+// Quality is the JPEG quality used, or 0 for other formats, and Size is the size of the output in bytes.
+// Duration is the total time spent on the input, including time queued between stages, and Timings breaks down the time spent working on it
+type Result struct {
+	InputPath  string
+	OutputPath string
+	Status     Status
+	Category   ErrorCategory
+	Err        error
+	Detection  *Detection
+	Strategy   RetryStrategy
+	Quality    int
+	Size       int64
+	Duration   time.Duration
+	Timings    Timings
+
+	// pendingDimensions is true if OutputPath contains {width} or {height} placeholders that are expanded after conversion
+	pendingDimensions bool
+}
+
+// Report is the result of converting a batch of inputs.
+// Results are in the same order as the inputs. Pruned contains the outputs removed by WithPrune
+type Report struct {
+	Results   []*Result
+	Pruned    []string
+	Converted int
+	Skipped   int
+	Unchanged int
+	Failed    int
+	Cancelled int
+	Detected  int
+	Duration  time.Duration
+}
+
+// tally computes the aggregate counts from r.Results
+func (r *Report) tally() {
+	r.Converted, r.Skipped, r.Unchanged, r.Failed, r.Cancelled, r.Detected = 0, 0, 0, 0, 0, 0
+	for _, res := range r.Results {
+		switch res.Status {
+		case StatusConverted:
+			r.Converted++
+		case StatusSkipped:
+			r.Skipped++
+		case StatusUnchanged:
+			r.Unchanged++
+		case StatusFailed:
+			r.Failed++
+		case StatusCancelled:
+			r.Cancelled++
+		case StatusDetected:
+			r.Detected++
+		}
+	}
+}
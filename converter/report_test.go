@@ -0,0 +1,45 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+func TestReportTally(t *testing.T) {
+	r := &Report{Converted: 10}
+	for _, status := range []Status{
+		StatusConverted, StatusConverted, StatusSkipped, StatusUnchanged,
+		StatusFailed, StatusFailed, StatusFailed, StatusCancelled, StatusDetected, "",
+	} {
+		r.Results = append(r.Results, &Result{Status: status})
+	}
+	r.tally()
+
+	want := Report{Converted: 2, Skipped: 1, Unchanged: 1, Failed: 3, Cancelled: 1, Detected: 1}
+	got := Report{Converted: r.Converted, Skipped: r.Skipped, Unchanged: r.Unchanged, Failed: r.Failed, Cancelled: r.Cancelled, Detected: r.Detected}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tally = %+v, want %+v", got, want)
+	}
+}
+
+func TestCategorizePortraitError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCategory
+	}{
+		{facedetect.ErrFaceUndetected, CategoryFaceUndetected},
+		{facedetect.ErrPupilsUndetected, CategoryPupilsUndetected},
+		{fmt.Errorf("could not frame portrait: %w", facedetect.ErrPupilsUndetected), CategoryPupilsUndetected},
+		{fmt.Errorf("could not frame portrait: %w", facedetect.ErrInvalidFace), CategorySidecar},
+		{errors.New("other"), CategoryFaceUndetected},
+	}
+
+	for _, test := range tests {
+		if got := categorizePortraitError(test.err); got != test.want {
+			t.Errorf("categorizePortraitError(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
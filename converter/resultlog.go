@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"sync"
+	"time"
+
+	pigo "github.com/esimov/pigo/core"
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// jsonPoint is a point in a JSON file
+type jsonPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// jsonRect is a rectangle in a JSON file
+type jsonRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// logTimings are the timings in a result log record, in milliseconds
+type logTimings struct {
+	Total  float64 `json:"total_ms"`
+	Decode float64 `json:"decode_ms"`
+	Detect float64 `json:"detect_ms"`
+	Render float64 `json:"render_ms"`
+	Encode float64 `json:"encode_ms"`
+}
+
+// logRecord is a line in a result log.
+// Face and the pupils are in the coordinates of the decoded input, and Crop is in the coordinates of the input rotated by Angle.
+// If Strategy is RetryOrient, the decoded input is the input with its EXIF orientation applied
+type logRecord struct {
+	InputPath  string        `json:"input_path"`
+	OutputPath string        `json:"output_path,omitempty"`
+	Status     Status        `json:"status"`
+	Category   ErrorCategory `json:"category,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Faces      *int          `json:"faces,omitempty"`
+	Face       *jsonRect     `json:"face,omitempty"`
+	FaceQ      float32       `json:"face_quality,omitempty"`
+	LeftPupil  *jsonPoint    `json:"left_pupil,omitempty"`
+	RightPupil *jsonPoint    `json:"right_pupil,omitempty"`
+	Angle      *float64      `json:"angle,omitempty"`
+	Crop       *jsonRect     `json:"crop,omitempty"`
+	Strategy   RetryStrategy `json:"strategy,omitempty"`
+	Quality    int           `json:"quality,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+	Timings    logTimings    `json:"timings"`
+}
+
+// milliseconds returns d in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// pupilPoint returns the point of pupil, or nil if it wasn't detected
+func pupilPoint(pupil *pigo.Puploc) *jsonPoint {
+	if pupil == nil || pupil.Row <= 0 || pupil.Col <= 0 {
+		return nil
+	}
+	return &jsonPoint{X: pupil.Col, Y: pupil.Row}
+}
+
+// newJSONRect returns r as a jsonRect, or nil if r is empty
+func newJSONRect(r image.Rectangle) *jsonRect {
+	if r.Empty() {
+		return nil
+	}
+	return &jsonRect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// newLogRecord returns the result log record for r
+func newLogRecord(r *Result) *logRecord {
+	rec := &logRecord{
+		InputPath:  r.InputPath,
+		OutputPath: r.OutputPath,
+		Status:     r.Status,
+		Category:   r.Category,
+		Strategy:   r.Strategy,
+		Quality:    r.Quality,
+		Size:       r.Size,
+		Timings: logTimings{
+			Total:  milliseconds(r.Duration),
+			Decode: milliseconds(r.Timings.Decode),
+			Detect: milliseconds(r.Timings.Detect),
+			Render: milliseconds(r.Timings.Render),
+			Encode: milliseconds(r.Timings.Encode),
+		},
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+
+	d := r.Detection
+	if d == nil {
+		return rec
+	}
+
+	rec.Faces = &d.Faces
+	if d.Face != nil {
+		rec.Face = newJSONRect(facedetect.DetectionRect(d.Face.Bounds))
+		rec.FaceQ = d.Face.Bounds.Q
+		rec.LeftPupil = pupilPoint(d.Face.LeftEye)
+		rec.RightPupil = pupilPoint(d.Face.RightEye)
+	}
+	if rec.Crop = newJSONRect(d.Crop); rec.Crop != nil {
+		rec.Angle = &d.Angle
+	}
+
+	return rec
+}
+
+// resultLog writes a JSON object for each result to w, one per line
+type resultLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newResultLog(w io.Writer) *resultLog {
+	if w == nil {
+		return nil
+	}
+	return &resultLog{enc: json.NewEncoder(w)}
+}
+
+// write writes the record for r to the log
+func (l *resultLog) write(r *Result) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(newLogRecord(r))
+}
@@ -0,0 +1,82 @@
+package convert
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	pigo "github.com/esimov/pigo/core"
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+func TestNewLogRecord(t *testing.T) {
+	face := &facedetect.Face{
+		Bounds:   pigo.Detection{Row: 100, Col: 80, Scale: 40, Q: 12.5},
+		LeftEye:  &pigo.Puploc{Row: 95, Col: 70},
+		RightEye: &pigo.Puploc{Row: -1, Col: -1},
+	}
+	r := &Result{
+		InputPath:  "in/jdoe.jpg",
+		OutputPath: "out/jdoe.jpg",
+		Status:     StatusConverted,
+		Strategy:   RetryRotate,
+		Quality:    90,
+		Size:       1234,
+		Detection:  &Detection{Faces: 2, Face: face, Angle: 0.25, Crop: image.Rect(10, 20, 110, 170)},
+		Duration:   1500 * time.Microsecond,
+		Timings:    Timings{Decode: time.Millisecond, Detect: 2 * time.Millisecond, Render: 250 * time.Microsecond, Encode: 0},
+	}
+
+	rec := newLogRecord(r)
+	if rec.InputPath != r.InputPath || rec.OutputPath != r.OutputPath || rec.Status != r.Status ||
+		rec.Strategy != RetryRotate || rec.Quality != 90 || rec.Size != 1234 {
+		t.Errorf("record = %+v, want the result's fields", rec)
+	}
+	if rec.Error != "" || rec.Category != CategoryNone {
+		t.Errorf("error = %q (%q), want none", rec.Error, rec.Category)
+	}
+	if want := (logTimings{Total: 1.5, Decode: 1, Detect: 2, Render: 0.25}); rec.Timings != want {
+		t.Errorf("timings = %+v, want %+v", rec.Timings, want)
+	}
+	if rec.Faces == nil || *rec.Faces != 2 {
+		t.Errorf("faces = %v, want 2", rec.Faces)
+	}
+	if want := (jsonRect{X: 60, Y: 80, Width: 40, Height: 40}); rec.Face == nil || *rec.Face != want {
+		t.Errorf("face = %+v, want %+v", rec.Face, want)
+	}
+	if rec.FaceQ != 12.5 {
+		t.Errorf("face quality = %v, want 12.5", rec.FaceQ)
+	}
+	if want := (jsonPoint{X: 70, Y: 95}); rec.LeftPupil == nil || *rec.LeftPupil != want {
+		t.Errorf("left pupil = %+v, want %+v", rec.LeftPupil, want)
+	}
+	if rec.RightPupil != nil {
+		t.Errorf("undetected right pupil = %+v, want nil", rec.RightPupil)
+	}
+	if want := (jsonRect{X: 10, Y: 20, Width: 100, Height: 150}); rec.Crop == nil || *rec.Crop != want {
+		t.Errorf("crop = %+v, want %+v", rec.Crop, want)
+	}
+	if rec.Angle == nil || *rec.Angle != 0.25 {
+		t.Errorf("angle = %v, want 0.25", rec.Angle)
+	}
+}
+
+func TestNewLogRecordFailed(t *testing.T) {
+	rec := newLogRecord(&Result{InputPath: "in/junk.jpg", Status: StatusFailed, Category: CategoryDecode, Err: errors.New("bad image")})
+	if rec.Status != StatusFailed || rec.Category != CategoryDecode || rec.Error != "bad image" {
+		t.Errorf("record = %+v, want the failure", rec)
+	}
+	if rec.Faces != nil || rec.Face != nil || rec.Crop != nil || rec.Angle != nil {
+		t.Errorf("record without a detection = %+v, want no detection fields", rec)
+	}
+
+	// an undetected face has a face count but no face or crop
+	rec = newLogRecord(&Result{Status: StatusFailed, Category: CategoryFaceUndetected, Detection: &Detection{}})
+	if rec.Faces == nil || *rec.Faces != 0 {
+		t.Errorf("faces = %v, want 0", rec.Faces)
+	}
+	if rec.Face != nil || rec.LeftPupil != nil || rec.Crop != nil || rec.Angle != nil {
+		t.Errorf("record without a face = %+v, want no face fields", rec)
+	}
+}
@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// RetryStrategy is a fallback tried when a face or its pupils can't be detected in an input
+type RetryStrategy string
+
+const (
+	// RetryOrient applies the input's EXIF orientation. It only applies if EXIF orientation is disabled with WithEXIF
+	RetryOrient RetryStrategy = "orient"
+	// RetryEqualize detects in a histogram equalized copy of the input, rendering the portrait from the original input
+	RetryEqualize RetryStrategy = "equalize"
+	// RetryRotate detects in copies of the input rotated by each of retryAngles
+	RetryRotate RetryStrategy = "rotate"
+	// RetryUpscale detects in a copy of the input upscaled by 2x, rendering the portrait from the upscaled input.
+	// It only applies to inputs whose longest side is shorter than retryUpscaleMaxSize
+	RetryUpscale RetryStrategy = "upscale"
+	// RetryRelaxed detects with facedetect.RelaxedDetectParams, which searches for smaller faces and keeps faces of any quality
+	RetryRelaxed RetryStrategy = "relaxed"
+)
+
+// DefaultRetryStrategies are all of the retry strategies, in the order they're usually worth trying
+var DefaultRetryStrategies = []RetryStrategy{RetryOrient, RetryEqualize, RetryRotate, RetryUpscale, RetryRelaxed}
+
+// retryAngles are the counter-clockwise rotations in degrees tried by RetryRotate
+var retryAngles = []float64{90, 270, 180, 20, -20, 40, -40}
+
+// retryUpscaleMaxSize is the longest side in pixels of inputs upscaled by RetryUpscale
+const retryUpscaleMaxSize = 2048
+
+// upscalable returns true if RetryUpscale applies to a w x h input
+func upscalable(w, h int) bool {
+	return w < retryUpscaleMaxSize && h < retryUpscaleMaxSize
+}
+
+var errRetryInapplicable = errors.New("strategy doesn't apply")
+
+// retry holds the state of framing an input, for retry strategies.
+// Strategies that frame a copy of img rotated angle degrees counter-clockwise and scaled by scale
+// set copied to the copy's bounds, so the framing can be mapped back to img
+type retry struct {
+	c      *config
+	r      *Result
+	img    *image.NRGBA
+	config *facedetect.PortraitConfig
+
+	copied image.Rectangle
+	angle  float64
+	scale  float64
+}
+
+// retryStrategies maps each strategy to a function that frames an input with it,
+// returning errRetryInapplicable if the strategy doesn't apply to the input
+var retryStrategies = map[RetryStrategy]func(rt *retry) (*facedetect.Framing, error){
+	RetryOrient: func(rt *retry) (*facedetect.Framing, error) {
+		if rt.c.useEXIF {
+			return nil, errRetryInapplicable
+		}
+		img, err := facedetect.DecodeFileWithEXIF(rt.r.InputPath)
+		if err != nil {
+			return nil, errRetryInapplicable
+		}
+		return rt.c.detector.Frame(img, rt.config)
+	},
+	RetryEqualize: func(rt *retry) (*facedetect.Framing, error) {
+		f, err := rt.c.detector.Frame(facedetect.Equalize(rt.img), rt.config)
+		if err != nil {
+			return f, err
+		}
+		// the geometry is the same, so render from the original
+		f.Rotated = imaging.Rotate(rt.img, f.Angle, color.NRGBA{})
+		return f, nil
+	},
+	RetryRotate: func(rt *retry) (f *facedetect.Framing, err error) {
+		for _, angle := range retryAngles {
+			rotated := imaging.Rotate(rt.img, angle, color.NRGBA{})
+			if f, err = rt.c.detector.Frame(rotated, rt.config); err == nil {
+				rt.copied, rt.angle, rt.scale = rotated.Bounds(), angle, 1
+				return f, nil
+			}
+		}
+		return f, err
+	},
+	RetryUpscale: func(rt *retry) (*facedetect.Framing, error) {
+		w, h := rt.img.Bounds().Dx(), rt.img.Bounds().Dy()
+		if !upscalable(w, h) {
+			return nil, errRetryInapplicable
+		}
+		upscaled := imaging.Resize(rt.img, w*2, h*2, imaging.Lanczos)
+		rt.copied, rt.angle, rt.scale = upscaled.Bounds(), 0, 2
+		return rt.c.detector.Frame(upscaled, rt.config)
+	},
+	RetryRelaxed: func(rt *retry) (*facedetect.Framing, error) {
+		relaxed := *rt.c.detector
+		relaxed.Params = []*facedetect.DetectParams{facedetect.RelaxedDetectParams}
+		return relaxed.Frame(rt.img, rt.config)
+	},
+}
+
+// ValidateRetryStrategies returns an error if any of strategies are unknown
+func ValidateRetryStrategies(strategies []RetryStrategy) error {
+	for _, s := range strategies {
+		if _, ok := retryStrategies[s]; !ok {
+			return fmt.Errorf("unknown retry strategy %q", s)
+		}
+	}
+	return nil
+}
+
+// retryFrame tries each of c.retries in order to frame img, setting r.Strategy to the first that succeeds.
+// The framing is returned to render the portrait from, along with its Detection in the coordinates of img.
+// If every strategy fails, nil is returned
+func (c *config) retryFrame(r *Result, img *image.NRGBA, config *facedetect.PortraitConfig) (*facedetect.Framing, *Detection) {
+	rt := &retry{c: c, r: r, img: img, config: config}
+	for _, strategy := range c.retries {
+		rt.copied = image.Rectangle{}
+		f, err := retryStrategies[strategy](rt)
+		if errors.Is(err, errRetryInapplicable) {
+			continue
+		}
+		if err != nil {
+			c.logger.Debug("retry strategy failed", "input_path", r.InputPath, "strategy", strategy, "error", err)
+			continue
+		}
+
+		c.logger.Debug("retry strategy succeeded", "input_path", r.InputPath, "strategy", strategy)
+		r.Strategy = strategy
+		if rt.copied.Empty() {
+			return f, newDetection(f)
+		}
+		return f, newDetection(f.Untransform(img.Bounds(), rt.copied, rt.angle, rt.scale))
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,131 @@
+package convert
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	pigo "github.com/esimov/pigo/core"
+	facedetect "github.com/korylprince/go-face-detect"
+	"github.com/korylprince/go-face-detect/cascade"
+)
+
+func TestValidateRetryStrategies(t *testing.T) {
+	if err := ValidateRetryStrategies(DefaultRetryStrategies); err != nil {
+		t.Errorf("DefaultRetryStrategies: %v", err)
+	}
+	if err := ValidateRetryStrategies(nil); err != nil {
+		t.Errorf("no strategies: %v", err)
+	}
+	for _, strategies := range [][]RetryStrategy{{"all"}, {RetryRotate, "spin"}, {""}} {
+		if err := ValidateRetryStrategies(strategies); err == nil {
+			t.Errorf("%q: expected error", strategies)
+		}
+	}
+}
+
+func TestCorrected(t *testing.T) {
+	eye := image.Pt(10, 10)
+	rect := image.Rect(0, 0, 10, 10)
+	rotation := 90.0
+	tests := []struct {
+		name  string
+		hints *facedetect.Hints
+		want  bool
+	}{
+		{"nil", nil, false},
+		{"config only", new(facedetect.Hints), false},
+		{"face", &facedetect.Hints{Face: &rect}, true},
+		{"eye", &facedetect.Hints{LeftEye: &eye}, true},
+		{"rotation", &facedetect.Hints{Rotation: &rotation}, true},
+	}
+
+	for _, test := range tests {
+		if got := corrected(test.hints); got != test.want {
+			t.Errorf("%s: corrected = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRetryFrameCoordinates(t *testing.T) {
+	img, err := imaging.Open(filepath.Join("..", "screenshot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upright, err := cascade.Detector.Frame(imaging.Clone(img), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := image.Pt(upright.Face.Bounds.Col, upright.Face.Bounds.Row)
+
+	// RetryRotate frames the input rotated 270 degrees by rotating it back 90 degrees
+	input := imaging.Rotate270(img)
+	c := &config{detector: cascade.Detector, logger: testLogger(), retries: []RetryStrategy{RetryRotate}}
+	r := &Result{InputPath: "face.png"}
+	f, d := c.retryFrame(r, input, facedetect.DefaultPortraitConfig)
+	if f == nil {
+		t.Fatal("RetryRotate didn't frame the rotated input")
+	}
+	if r.Strategy != RetryRotate {
+		t.Errorf("strategy = %q, want %q", r.Strategy, RetryRotate)
+	}
+
+	// rotating 270 degrees counter-clockwise moves (x, y) to (h-1-y, x)
+	want := image.Pt(img.Bounds().Dy()-1-center.Y, center.X)
+	if got := image.Pt(d.Face.Bounds.Col, d.Face.Bounds.Row); math.Abs(float64(got.X-want.X)) > 2 || math.Abs(float64(got.Y-want.Y)) > 2 {
+		t.Errorf("face center = %v, want %v in the input", got, want)
+	}
+	// pupil localization is randomized, so the angle and crop vary slightly between framings
+	if want := upright.Angle + 90; math.Abs(d.Angle-want) > 3 {
+		t.Errorf("angle = %v, want %v", d.Angle, want)
+	}
+	if got, want := d.Crop.Size(), upright.Crop.Size(); math.Abs(float64(got.X-want.X)) > 0.05*float64(want.X) ||
+		math.Abs(float64(got.Y-want.Y)) > 0.05*float64(want.Y) {
+		t.Errorf("crop size = %v, want %v", got, want)
+	}
+	if !d.Crop.In(facedetect.RotatedBounds(input.Bounds(), d.Angle)) {
+		t.Errorf("crop %v is outside the input rotated by %v", d.Crop, d.Angle)
+	}
+}
+
+func TestRelaxedQuality(t *testing.T) {
+	for _, params := range []*facedetect.DetectParams{facedetect.FastDetectParams, facedetect.SlowDetectParams} {
+		if facedetect.RelaxedDetectParams.MinQuality >= params.MinQuality {
+			t.Errorf("relaxed minimum quality %v isn't lower than %v", facedetect.RelaxedDetectParams.MinQuality, params.MinQuality)
+		}
+	}
+
+	img, err := imaging.Open(filepath.Join("..", "screenshot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	params := pigo.ImageParams{Pixels: pigo.RgbToGrayscale(img), Rows: b.Dy(), Cols: b.Dx(), Dim: b.Dx()}
+
+	unfiltered := *facedetect.SlowDetectParams
+	unfiltered.MinQuality = 0
+	all := cascade.Detector.DetectFaces(params, &unfiltered, 0)
+	filtered := unfiltered
+	filtered.MinQuality = 100
+	kept := cascade.Detector.DetectFaces(params, &filtered, 0)
+
+	var want int
+	for _, face := range all {
+		if face.Q >= filtered.MinQuality {
+			want++
+		}
+	}
+	if want == 0 || want == len(all) {
+		t.Fatalf("%d of %d faces have quality %v or more, want some but not all", want, len(all), filtered.MinQuality)
+	}
+	if len(kept) != want {
+		t.Errorf("kept %d faces, want %d", len(kept), want)
+	}
+	for _, face := range kept {
+		if face.Q < filtered.MinQuality {
+			t.Errorf("kept face %+v below the minimum quality %v", face, filtered.MinQuality)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// RosterColumns are the names of the roster CSV columns containing each field.
+// Name is optional
+type RosterColumns struct {
+	ID   string
+	Name string
+	Path string
+}
+
+// DefaultRosterColumns are the default roster CSV column names
+var DefaultRosterColumns = RosterColumns{ID: "id", Name: "name", Path: "path"}
+
+// RosterStatusMissing is the status written by Roster.WriteStatus for rows without a photo path
+const RosterStatusMissing = "missing"
+
+// RosterEntry is a row in a roster
+type RosterEntry struct {
+	ID   string
+	Name string
+	// Path is the photo path, resolved relative to the roster's directory, or "" if the row has no photo
+	Path string
+	// Missing is true if Path is set but the photo doesn't exist
+	Missing bool
+}
+
+// hasPhoto returns true if e has a photo path that exists
+func (e *RosterEntry) hasPhoto() bool {
+	return e.Path != "" && !e.Missing
+}
+
+// Roster is a CSV mapping IDs and names to input photos, used to select inputs and name outputs
+type Roster struct {
+	header  []string
+	rows    [][]string
+	entries []*RosterEntry
+}
+
+// columnIndex returns the index of name in header, ignoring case and surrounding space, or -1 if it isn't found
+func columnIndex(header []string, name string) int {
+	for idx, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// ReadRoster reads a roster CSV with a header row from r, using columns to find each field.
+// Relative photo paths are resolved relative to dir, and entries whose photo doesn't exist are marked Missing
+func ReadRoster(r io.Reader, columns RosterColumns, dir string) (*Roster, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("roster is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read roster header: %w", err)
+	}
+
+	idIdx, nameIdx, pathIdx := columnIndex(header, columns.ID), -1, columnIndex(header, columns.Path)
+	if idIdx == -1 {
+		return nil, fmt.Errorf("roster is missing ID column %q", columns.ID)
+	}
+	if pathIdx == -1 {
+		return nil, fmt.Errorf("roster is missing path column %q", columns.Path)
+	}
+	if columns.Name != "" {
+		if nameIdx = columnIndex(header, columns.Name); nameIdx == -1 {
+			return nil, fmt.Errorf("roster is missing name column %q", columns.Name)
+		}
+	}
+
+	field := func(row []string, idx int) string {
+		if idx < 0 || idx >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[idx])
+	}
+
+	roster := &Roster{header: header}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read roster: %w", err)
+		}
+
+		entry := &RosterEntry{ID: field(row, idIdx), Name: field(row, nameIdx), Path: field(row, pathIdx)}
+		if entry.Path != "" && !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(dir, entry.Path)
+		}
+		if entry.Path != "" {
+			if _, err := os.Stat(entry.Path); errors.Is(err, os.ErrNotExist) {
+				entry.Missing = true
+			}
+		}
+		roster.rows = append(roster.rows, row)
+		roster.entries = append(roster.entries, entry)
+	}
+
+	return roster, nil
+}
+
+// Entries returns the rows of the roster
+func (r *Roster) Entries() []*RosterEntry {
+	return r.entries
+}
+
+// withPhotos returns the entries with a photo path that exists
+func (r *Roster) withPhotos() []*RosterEntry {
+	var entries []*RosterEntry
+	for _, e := range r.entries {
+		if e.hasPhoto() {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// WriteStatus writes the roster to w with status, category, error, and output_path columns appended,
+// using report from ConvertRoster. Rows without a photo path or whose photo doesn't exist have RosterStatusMissing
+func (r *Roster) WriteStatus(w io.Writer, report *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(append([]string{}, r.header...), "status", "category", "error", "output_path")); err != nil {
+		return fmt.Errorf("could not write roster status: %w", err)
+	}
+
+	results := report.Results
+	for idx, entry := range r.entries {
+		row := append([]string{}, r.rows[idx]...)
+		for len(row) < len(r.header) {
+			row = append(row, "")
+		}
+
+		switch {
+		case entry.Missing:
+			row = append(row, RosterStatusMissing, "", "photo doesn't exist: "+entry.Path, "")
+		case entry.Path == "" || len(results) == 0:
+			row = append(row, RosterStatusMissing, "", "", "")
+		default:
+			res := results[0]
+			results = results[1:]
+			var errStr string
+			if res.Err != nil {
+				errStr = res.Err.Error()
+			}
+			row = append(row, string(res.Status), string(res.Category), errStr, res.OutputPath)
+		}
+
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("could not write roster status: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("could not write roster status: %w", err)
+	}
+
+	return nil
+}
+
+// sanitizeName replaces characters that aren't allowed in file names on common filesystems
+var sanitizeName = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_",
+).Replace
+
+// usesRoster returns true if template contains the {id} or {name} placeholders
+func usesRoster(template string) bool {
+	return strings.Contains(template, "{id}") || strings.Contains(template, "{name}")
+}
+
+// ConvertRoster converts the photos of the entries in roster with ConvertPortraitsContext.
+// Output name templates can use the {id} and {name} placeholders, which are expanded with the entry's fields.
+// The report's Results are in the same order as the roster's entries with photos, and can be written with roster.WriteStatus
+func ConvertRoster(ctx context.Context, detector *facedetect.Detector, roster *Roster, outdir string, opts ...ConvertOption) (*Report, error) {
+	entries := roster.withPhotos()
+	infiles := make([]string, len(entries))
+	for idx, e := range entries {
+		infiles[idx] = e.Path
+	}
+
+	return ConvertPortraitsContext(ctx, detector, infiles, outdir, append(opts, func(c *config) {
+		c.roster, c.fromRoster = entries, true
+	})...)
+}
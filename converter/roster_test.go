@@ -0,0 +1,120 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadRoster(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "photos", "ann.jpg"), "photo")
+	abs := filepath.Join(dir, "bob.jpg")
+	writeFile(t, abs, "photo")
+
+	csv := "Student ID, Full Name ,Photo\n" +
+		"1004,Ann Lee,photos/ann.jpg\n" +
+		"1005,Bob Ray," + abs + "\n" +
+		"1006,Cal Doe,\n" +
+		"1007,Dee Fox,photos/dee.jpg\n" +
+		"1008\n"
+	columns := RosterColumns{ID: "student id", Name: "full name", Path: "photo"}
+	roster, err := ReadRoster(strings.NewReader(csv), columns, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RosterEntry{
+		{ID: "1004", Name: "Ann Lee", Path: filepath.Join(dir, "photos", "ann.jpg")},
+		{ID: "1005", Name: "Bob Ray", Path: abs},
+		{ID: "1006", Name: "Cal Doe"},
+		{ID: "1007", Name: "Dee Fox", Path: filepath.Join(dir, "photos", "dee.jpg"), Missing: true},
+		{ID: "1008"},
+	}
+	entries := roster.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for idx, e := range entries {
+		if *e != want[idx] {
+			t.Errorf("entry %d = %+v, want %+v", idx, *e, want[idx])
+		}
+	}
+
+	photos := roster.withPhotos()
+	if len(photos) != 2 || photos[0] != entries[0] || photos[1] != entries[1] {
+		t.Errorf("withPhotos returned %v, want the first two entries", photos)
+	}
+}
+
+func TestReadRosterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		columns RosterColumns
+	}{
+		{"empty", "", DefaultRosterColumns},
+		{"missing ID column", "name,path\nAnn,ann.jpg\n", DefaultRosterColumns},
+		{"missing path column", "id,name\n1004,Ann\n", DefaultRosterColumns},
+		{"missing name column", "id,path\n1004,ann.jpg\n", DefaultRosterColumns},
+		{"malformed", "id,name,path\n\"1004,Ann,ann.jpg\n", DefaultRosterColumns},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadRoster(strings.NewReader(test.csv), test.columns, "."); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	if _, err := ReadRoster(strings.NewReader("id,path\n1004,ann.jpg\n"), RosterColumns{ID: "id", Path: "path"}, "."); err != nil {
+		t.Errorf("optional name column: %v", err)
+	}
+}
+
+func TestRosterWriteStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "ann.jpg"), "photo")
+	writeFile(t, filepath.Join(dir, "eve.jpg"), "photo")
+
+	csv := "id,name,path,notes\n" +
+		"1004,Ann,ann.jpg,first\n" +
+		"1005,Bob,,\n" +
+		"1006,Cal,cal.jpg\n" +
+		"1007,Eve,eve.jpg,last\n"
+	roster, err := ReadRoster(strings.NewReader(csv), DefaultRosterColumns, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := &Report{Results: []*Result{
+		{InputPath: filepath.Join(dir, "ann.jpg"), OutputPath: "out/1004.jpg", Status: StatusConverted},
+		{InputPath: filepath.Join(dir, "eve.jpg"), OutputPath: "out/1007.jpg", Status: StatusFailed, Category: CategoryFaceUndetected, Err: errors.New("face undetected")},
+	}}
+	buf := new(strings.Builder)
+	if err = roster.WriteStatus(buf, report); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,name,path,notes,status,category,error,output_path\n" +
+		"1004,Ann,ann.jpg,first,converted,,,out/1004.jpg\n" +
+		"1005,Bob,,,missing,,,\n" +
+		"1006,Cal,cal.jpg,,missing,,photo doesn't exist: " + filepath.Join(dir, "cal.jpg") + ",\n" +
+		"1007,Eve,eve.jpg,last,failed,face-undetected,face undetected,out/1007.jpg\n"
+	if buf.String() != want {
+		t.Errorf("status =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestConvertRosterWithoutPhotos(t *testing.T) {
+	roster, err := ReadRoster(strings.NewReader("id,name,path\n1004,Ann,\n1005,Bob,missing.jpg\n"), DefaultRosterColumns, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ConvertRoster(context.Background(), nil, roster, t.TempDir(), WithLogger(testLogger()), WithNameTemplate("{id}{ext}"))
+	if err == nil || !strings.Contains(err.Error(), "no rows with photos") {
+		t.Errorf("error = %v, want roster has no rows with photos", err)
+	}
+}
@@ -0,0 +1,104 @@
+package convert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// SidecarExt is appended to an input's path to find its sidecar, e.g. photo.jpg.json
+const SidecarExt = ".json"
+
+// sidecar contains manual corrections for an input.
+// Coordinates are in pixels of the decoded input, after applying its EXIF orientation if enabled.
+// Config contains facedetect.PortraitConfig fields that override the converter's configuration for the input
+type sidecar struct {
+	Face     *jsonRect       `json:"face"`
+	LeftEye  *jsonPoint      `json:"left_eye"`
+	RightEye *jsonPoint      `json:"right_eye"`
+	Rotation *float64        `json:"rotation"`
+	Config   json.RawMessage `json:"config"`
+}
+
+// decodeStrict decodes the JSON in buf into v, returning an error for unknown fields
+func decodeStrict(buf []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// readSidecar reads the sidecar for inpath, returning nil if it doesn't exist
+func readSidecar(inpath string) (*sidecar, error) {
+	buf, err := os.ReadFile(inpath + SidecarExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read sidecar: %w", err)
+	}
+
+	s := new(sidecar)
+	if err = decodeStrict(buf, s); err != nil {
+		return nil, fmt.Errorf("could not parse sidecar: %w", err)
+	}
+
+	return s, nil
+}
+
+// hints returns the manual corrections in s
+func (s *sidecar) hints() *facedetect.Hints {
+	h := &facedetect.Hints{Rotation: s.Rotation}
+	if s.Face != nil {
+		r := image.Rect(s.Face.X, s.Face.Y, s.Face.X+s.Face.Width, s.Face.Y+s.Face.Height)
+		h.Face = &r
+	}
+	if s.LeftEye != nil {
+		p := image.Pt(s.LeftEye.X, s.LeftEye.Y)
+		h.LeftEye = &p
+	}
+	if s.RightEye != nil {
+		p := image.Pt(s.RightEye.X, s.RightEye.Y)
+		h.RightEye = &p
+	}
+	return h
+}
+
+// portraitConfig returns a copy of config with the overrides in s applied, or config if s has no overrides
+func (s *sidecar) portraitConfig(config *facedetect.PortraitConfig) (*facedetect.PortraitConfig, error) {
+	if len(s.Config) == 0 {
+		return config, nil
+	}
+
+	override := *config
+	if err := decodeStrict(s.Config, &override); err != nil {
+		return nil, fmt.Errorf("could not parse sidecar config: %w", err)
+	}
+
+	return &override, nil
+}
+
+// hashInput returns the hex encoded SHA-256 hash of the input of r, including its sidecar if c.sidecars is set
+func (c *config) hashInput(r *Result) (string, error) {
+	hash, err := hashFile(r.InputPath)
+	if err != nil || !c.sidecars {
+		return hash, err
+	}
+
+	sidecarHash, err := hashFile(r.InputPath + SidecarExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return hash, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(hash + sidecarHash))
+	return hex.EncodeToString(sum[:]), nil
+}
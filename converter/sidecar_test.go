@@ -0,0 +1,78 @@
+package convert
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+func TestReadSidecar(t *testing.T) {
+	dir := t.TempDir()
+	inpath := filepath.Join(dir, "jdoe.jpg")
+
+	s, err := readSidecar(inpath)
+	if err != nil || s != nil {
+		t.Fatalf("missing sidecar = %+v, %v, want nil, nil", s, err)
+	}
+
+	writeFile(t, inpath+SidecarExt, `{"face": {"x": 10, "y": 20, "width": 30, "height": 40}, "left_eye": {"x": 15, "y": 30},
+		"rotation": 90, "config": {"Headroom": 0.2}}`)
+	if s, err = readSidecar(inpath); err != nil {
+		t.Fatal(err)
+	}
+	h := s.hints()
+	if h.Face == nil || *h.Face != image.Rect(10, 20, 40, 60) {
+		t.Errorf("face = %v, want %v", h.Face, image.Rect(10, 20, 40, 60))
+	}
+	if h.LeftEye == nil || *h.LeftEye != image.Pt(15, 30) {
+		t.Errorf("left eye = %v, want %v", h.LeftEye, image.Pt(15, 30))
+	}
+	if h.RightEye != nil {
+		t.Errorf("right eye = %v, want nil", h.RightEye)
+	}
+	if h.Rotation == nil || *h.Rotation != 90 {
+		t.Errorf("rotation = %v, want 90", h.Rotation)
+	}
+
+	for name, content := range map[string]string{
+		"unknown field": `{"nose": {"x": 1, "y": 2}}`,
+		"invalid JSON":  `{"face":`,
+	} {
+		writeFile(t, inpath+SidecarExt, content)
+		if s, err = readSidecar(inpath); err == nil {
+			t.Errorf("%s: sidecar = %+v, want an error", name, s)
+		}
+	}
+}
+
+func TestSidecarPortraitConfig(t *testing.T) {
+	config := facedetect.DefaultPortraitConfig
+
+	got, err := new(sidecar).portraitConfig(config)
+	if err != nil || got != config {
+		t.Errorf("no overrides = %p, %v, want the converter's config %p", got, err, config)
+	}
+
+	got, err = (&sidecar{Config: []byte(`{"Headroom": 0.3, "Style": "sepia"}`)}).portraitConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == config {
+		t.Fatal("overrides returned the converter's config instead of a copy")
+	}
+	if got.Headroom != 0.3 || got.Style != facedetect.StyleSepia {
+		t.Errorf("overridden config = %+v, want Headroom 0.3 and Style sepia", got)
+	}
+	if got.AspectRatio != config.AspectRatio || got.JPEGQuality != config.JPEGQuality {
+		t.Errorf("overrides changed other fields: %+v", got)
+	}
+	if config.Headroom == 0.3 {
+		t.Error("overrides modified the converter's config")
+	}
+
+	if got, err = (&sidecar{Config: []byte(`{"Headrom": 0.3}`)}).portraitConfig(config); err == nil {
+		t.Errorf("unknown override = %+v, want an error", got)
+	}
+}
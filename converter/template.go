@@ -0,0 +1,123 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+// DefaultNameTemplate names outputs the same as their inputs
+const DefaultNameTemplate = "{base}{ext}"
+
+// placeholderRegexp matches output name template placeholders
+var placeholderRegexp = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// namePlaceholders are the placeholders supported by output name templates
+var namePlaceholders = map[string]bool{
+	"base":   true,
+	"ext":    true,
+	"width":  true,
+	"height": true,
+	"preset": true,
+	"hash":   true,
+	"index":  true,
+	"id":     true,
+	"name":   true,
+}
+
+// validateNameTemplate returns an error if template contains unknown placeholders
+func validateNameTemplate(template string) error {
+	if template == "" {
+		return errors.New("empty name template")
+	}
+	for _, m := range placeholderRegexp.FindAllStringSubmatch(template, -1) {
+		if !namePlaceholders[m[1]] {
+			return fmt.Errorf("unknown placeholder %s in name template", m[0])
+		}
+	}
+	return nil
+}
+
+// validateNameExt returns an error if outputs named by template have no format,
+// because template doesn't end with {ext} or an image extension and config doesn't choose the output format
+func validateNameExt(template string, config *facedetect.PortraitConfig) error {
+	if strings.HasSuffix(template, "{ext}") {
+		return nil
+	}
+	if _, err := config.OutputFormat(template); err != nil {
+		return fmt.Errorf("name template %s has no image extension: end it with {ext} or an extension like .jpg, or set the output format", template)
+	}
+	return nil
+}
+
+// expandTemplate replaces placeholders in template with values, leaving placeholders without a value as-is
+func expandTemplate(template string, values map[string]string) string {
+	return placeholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if v, ok := values[placeholder[1:len(placeholder)-1]]; ok {
+			return v
+		}
+		return placeholder
+	})
+}
+
+// hasDimensions returns true if path contains the {width} or {height} placeholders,
+// which can only be expanded after the portrait has been created
+func hasDimensions(path string) bool {
+	return strings.Contains(path, "{width}") || strings.Contains(path, "{height}")
+}
+
+// expandDimensions replaces the {width} and {height} placeholders in path
+func expandDimensions(path string, width, height int) string {
+	return expandTemplate(path, map[string]string{"width": strconv.Itoa(width), "height": strconv.Itoa(height)})
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file at path
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outputName returns the output file name for the input at inpath and index using c.nameTemplate.
+// {id} and {name} are expanded from the roster entry at index. {width} and {height} are left unexpanded
+func (c *config) outputName(inpath string, index int) (string, error) {
+	ext := filepath.Ext(inpath)
+	values := map[string]string{
+		"base":   strings.TrimSuffix(filepath.Base(inpath), ext),
+		"ext":    ext,
+		"preset": c.portraitConfig.Name,
+		"index":  strconv.Itoa(index + 1),
+	}
+	if c.roster != nil {
+		values["id"] = sanitizeName(c.roster[index].ID)
+		values["name"] = sanitizeName(c.roster[index].Name)
+	}
+
+	if strings.Contains(c.nameTemplate, "{hash}") {
+		hash, err := hashFile(inpath)
+		if err != nil {
+			return "", fmt.Errorf("could not hash input: %w", err)
+		}
+		values["hash"] = hash[:12]
+	}
+
+	return expandTemplate(c.nameTemplate, values), nil
+}
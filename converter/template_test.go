@@ -0,0 +1,129 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	facedetect "github.com/korylprince/go-face-detect"
+)
+
+func TestValidateNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{DefaultNameTemplate, true},
+		{"{preset}/{base}-{width}x{height}{ext}", true},
+		{"{id}-{name}.jpg", true},
+		{"{index}-{hash}{ext}", true},
+		{"portrait.jpg", true},
+		{"", false},
+		{"{base}-{size}{ext}", false},
+		{"{Base}{ext}", true},
+	}
+
+	for _, test := range tests {
+		if err := validateNameTemplate(test.template); (err == nil) != test.valid {
+			t.Errorf("validateNameTemplate(%q) = %v, want valid %t", test.template, err, test.valid)
+		}
+	}
+}
+
+func TestValidateNameExt(t *testing.T) {
+	masked := *facedetect.DefaultPortraitConfig
+	masked.Mask = facedetect.MaskCircle
+	jpeg := *facedetect.DefaultPortraitConfig
+	jpeg.Format = facedetect.FormatJPEG
+	capped := *facedetect.DefaultPortraitConfig
+	capped.MaxFileSize = 100000
+
+	tests := []struct {
+		template string
+		config   *facedetect.PortraitConfig
+		valid    bool
+	}{
+		{DefaultNameTemplate, facedetect.DefaultPortraitConfig, true},
+		{"{index}_{width}x{height}.jpg", facedetect.DefaultPortraitConfig, true},
+		{"{base}.PNG", facedetect.DefaultPortraitConfig, true},
+		{"{index}", facedetect.DefaultPortraitConfig, false},
+		{"{base}.{hash}", facedetect.DefaultPortraitConfig, false},
+		{"{base}{ext}.bak", facedetect.DefaultPortraitConfig, false},
+		{"{index}", &masked, true},
+		{"{index}", &jpeg, true},
+		{"{index}", &capped, true},
+	}
+
+	for _, test := range tests {
+		if err := validateNameExt(test.template, test.config); (err == nil) != test.valid {
+			t.Errorf("validateNameExt(%q) = %v, want valid %t", test.template, err, test.valid)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	values := map[string]string{"base": "jdoe", "ext": ".jpg", "preset": "badge", "empty": ""}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{DefaultNameTemplate, "jdoe.jpg"},
+		{"{preset}/{base}{ext}", "badge/jdoe.jpg"},
+		{"{base}-{width}x{height}{ext}", "jdoe-{width}x{height}.jpg"},
+		{"{base}{empty}{ext}", "jdoe.jpg"},
+		{"{base}{base}", "jdoejdoe"},
+		{"{Base}{ext}", "{Base}.jpg"},
+		{"{{base}}", "{jdoe}"},
+	}
+
+	for _, test := range tests {
+		if got := expandTemplate(test.template, values); got != test.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", test.template, got, test.want)
+		}
+	}
+}
+
+func TestExpandDimensions(t *testing.T) {
+	if !hasDimensions("{base}-{width}{ext}") || hasDimensions("{base}{ext}") {
+		t.Error("hasDimensions didn't detect {width}")
+	}
+	if got, want := expandDimensions("out/jdoe-{width}x{height}.jpg", 300, 400), "out/jdoe-300x400.jpg"; got != want {
+		t.Errorf("expandDimensions = %q, want %q", got, want)
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	dir := t.TempDir()
+	inpath := filepath.Join(dir, "jdoe.jpg")
+	if err := os.WriteFile(inpath, []byte("portrait"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashFile(inpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template string
+		roster   []*RosterEntry
+		want     string
+	}{
+		{DefaultNameTemplate, nil, "jdoe.jpg"},
+		{"{index}-{base}{ext}", nil, "2-jdoe.jpg"},
+		{"{preset}-{base}{ext}", nil, "default-jdoe.jpg"},
+		{"{hash}{ext}", nil, hash[:12] + ".jpg"},
+		{"{id}-{name}{ext}", []*RosterEntry{{}, {ID: "1004", Name: "Lee: Ann/B"}}, "1004-Lee_ Ann_B.jpg"},
+	}
+
+	for _, test := range tests {
+		c := &config{nameTemplate: test.template, portraitConfig: facedetect.DefaultPortraitConfig, roster: test.roster}
+		got, err := c.outputName(inpath, 1)
+		if err != nil {
+			t.Errorf("outputName(%q) returned error: %v", test.template, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("outputName(%q) = %q, want %q", test.template, got, test.want)
+		}
+	}
+}
@@ -17,13 +17,15 @@ var (
 // MaxSizeFactor is the largest size area searched for as a percentage of the largest dimension of the image.
 // ShiftFactor determines to what percentage to move the detection window over its size.
 // ScaleFactor defines in percentage the resize value of the detection window when moving to a higher scale.
-// IoUThreshold is the threshold to consider multiple face regions the same face
+// IoUThreshold is the threshold to consider multiple face regions the same face.
+// MinQuality is the lowest quality (Q) of a detected face that isn't discarded
 type DetectParams struct {
 	MinSizeFactor float64
 	MaxSizeFactor float64
 	ShiftFactor   float64
 	ScaleFactor   float64
 	IoUThreshold  float64
+	MinQuality    float32
 }
 
 var FastDetectParams = &DetectParams{
@@ -32,6 +34,7 @@ var FastDetectParams = &DetectParams{
 	ShiftFactor:   0.15,
 	ScaleFactor:   1.15,
 	IoUThreshold:  0.15,
+	MinQuality:    5,
 }
 
 var SlowDetectParams = &DetectParams{
@@ -40,11 +43,27 @@ var SlowDetectParams = &DetectParams{
 	ShiftFactor:   0.05,
 	ScaleFactor:   1.03,
 	IoUThreshold:  0,
+	MinQuality:    5,
 }
 
+// RelaxedDetectParams searches more exhaustively than SlowDetectParams and keeps faces of any quality,
+// finding smaller and lower quality faces at the cost of speed and more false positives
+var RelaxedDetectParams = &DetectParams{
+	MinSizeFactor: 0.05,
+	MaxSizeFactor: 1,
+	ShiftFactor:   0.04,
+	ScaleFactor:   1.03,
+	IoUThreshold:  0,
+	MinQuality:    0,
+}
+
+// Detector detects faces and pupils.
+// Params are the detection parameters tried in order until a face is detected.
+// If Params is nil, FastDetectParams then SlowDetectParams are used
 type Detector struct {
 	FaceCascade  *pigo.Pigo
 	PupilCascade *pigo.PuplocCascade
+	Params       []*DetectParams
 }
 
 type Face struct {
@@ -69,7 +88,16 @@ func (d *Detector) DetectFaces(img pigo.ImageParams, params *DetectParams, angle
 	// find all faces
 	faces := d.FaceCascade.RunCascade(p, angle)
 	// filter duplicate faces
-	return d.FaceCascade.ClusterDetections(faces, params.IoUThreshold)
+	faces = d.FaceCascade.ClusterDetections(faces, params.IoUThreshold)
+
+	// filter low quality faces
+	kept := faces[:0]
+	for _, face := range faces {
+		if face.Q >= params.MinQuality {
+			kept = append(kept, face)
+		}
+	}
+	return kept
 }
 
 // ChooseBestFace returns the face with the highest quality (Q)
@@ -109,32 +137,62 @@ func (d *Detector) DetectPupils(img pigo.ImageParams, face pigo.Detection, angle
 	return leftEye, rightEye
 }
 
-// DetectFace detects a single face and pupils in an image, returning the detected areas.
-// DetectFace attempts detection using FastDetectParams, falling back to SlowDetectParams if a face isn't detected
-func (d *Detector) DetectFace(img *image.NRGBA, angle float64) (*Face, error) {
+// imageParams returns the grayscale image parameters used for detection in img
+func imageParams(img *image.NRGBA) pigo.ImageParams {
 	x, y := img.Bounds().Max.X, img.Bounds().Max.Y
-	params := pigo.ImageParams{
+	return pigo.ImageParams{
 		Pixels: pigo.RgbToGrayscale(img),
 		Cols:   x,
 		Rows:   y,
 		Dim:    x,
 	}
+}
 
+// detectAllFaces detects faces using each of d.Params in order until faces are detected
+func (d *Detector) detectAllFaces(params pigo.ImageParams, angle float64) []pigo.Detection {
 	// try to detect faces with faster detection first and fallback to slower detection if it fails
-	faces := d.DetectFaces(params, FastDetectParams, angle)
-	if len(faces) == 0 {
-		faces = d.DetectFaces(params, SlowDetectParams, angle)
-		if len(faces) == 0 {
-			return nil, ErrFaceUndetected
+	detectParams := d.Params
+	if detectParams == nil {
+		detectParams = []*DetectParams{FastDetectParams, SlowDetectParams}
+	}
+
+	var faces []pigo.Detection
+	for _, p := range detectParams {
+		if faces = d.DetectFaces(params, p, angle); len(faces) > 0 {
+			break
 		}
 	}
+	return faces
+}
+
+// PupilsDetected returns true if both of f's pupils were detected
+func (f *Face) PupilsDetected() bool {
+	return f.LeftEye != nil && f.RightEye != nil &&
+		f.LeftEye.Row > 0 && f.LeftEye.Col > 0 && f.RightEye.Row > 0 && f.RightEye.Col > 0
+}
+
+// detectFace detects a single face and pupils in an image, returning the chosen face and all detected faces
+func (d *Detector) detectFace(img *image.NRGBA, angle float64) (*Face, []pigo.Detection, error) {
+	params := imageParams(img)
+
+	faces := d.detectAllFaces(params, angle)
+	if len(faces) == 0 {
+		return nil, faces, ErrFaceUndetected
+	}
 
 	face := &Face{Bounds: ChooseBestFace(faces)}
 
 	face.LeftEye, face.RightEye = d.DetectPupils(params, face.Bounds, angle)
-	if face.LeftEye.Row <= 0 || face.LeftEye.Col <= 0 || face.RightEye.Row <= 0 || face.RightEye.Col <= 0 {
-		return face, ErrPupilsUndetected
+	if !face.PupilsDetected() {
+		return face, faces, ErrPupilsUndetected
 	}
 
-	return face, nil
+	return face, faces, nil
+}
+
+// DetectFace detects a single face and pupils in an image, returning the detected areas.
+// DetectFace attempts detection using each of d.Params in order until a face is detected
+func (d *Detector) DetectFace(img *image.NRGBA, angle float64) (*Face, error) {
+	face, _, err := d.detectFace(img, angle)
+	return face, err
 }
@@ -0,0 +1,105 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	pigo "github.com/esimov/pigo/core"
+)
+
+var (
+	annotateFaceColor   = color.NRGBA{255, 200, 0, 255}
+	annotateChosenColor = color.NRGBA{0, 220, 0, 255}
+	annotatePupilColor  = color.NRGBA{255, 0, 0, 255}
+)
+
+// Diagnosis describes what the detector saw in an image.
+// Faces contains every detected face. Face is the face Portrait would choose, with its pupils, or nil if no face was detected
+type Diagnosis struct {
+	Width          int              `json:"width"`
+	Height         int              `json:"height"`
+	Faces          []pigo.Detection `json:"faces"`
+	Face           *Face            `json:"face"`
+	PupilsDetected bool             `json:"pupils_detected"`
+}
+
+// Diagnose detects all faces in img and the pupils of the best face, without rotating or cropping it
+func (d *Detector) Diagnose(img *image.NRGBA) *Diagnosis {
+	params := imageParams(img)
+	diag := &Diagnosis{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Faces:  d.detectAllFaces(params, 0),
+	}
+	if len(diag.Faces) == 0 {
+		return diag
+	}
+
+	diag.Face = &Face{Bounds: ChooseBestFace(diag.Faces)}
+	diag.Face.LeftEye, diag.Face.RightEye = d.DetectPupils(params, diag.Face.Bounds, 0)
+	diag.PupilsDetected = diag.Face.PupilsDetected()
+
+	return diag
+}
+
+// fillRect fills r in img with c
+func fillRect(img *image.NRGBA, r image.Rectangle, c color.NRGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+}
+
+// strokeRect draws the outline of r in img with c and the given line width
+func strokeRect(img *image.NRGBA, r image.Rectangle, c color.NRGBA, width int) {
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width), c)
+	fillRect(img, image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+width, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Max.X-width, r.Min.Y, r.Max.X, r.Max.Y), c)
+}
+
+// strokeCircle draws the outline of the circle at center with radius in img with c and the given line width
+func strokeCircle(img *image.NRGBA, center image.Point, radius int, c color.NRGBA, width int) {
+	outer, inner := radius*radius, maxInt(radius-width, 0)*maxInt(radius-width, 0)
+	r := image.Rect(center.X-radius, center.Y-radius, center.X+radius+1, center.Y+radius+1).Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dx, dy := x-center.X, y-center.Y
+			if d := dx*dx + dy*dy; d <= outer && d >= inner {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// DetectionRect returns the bounding box of det
+func DetectionRect(det pigo.Detection) image.Rectangle {
+	return image.Rect(det.Col-det.Scale/2, det.Row-det.Scale/2, det.Col+det.Scale/2, det.Row+det.Scale/2)
+}
+
+// Annotate returns a copy of img with the faces in diag outlined in yellow, the chosen face outlined in green,
+// and detected pupils circled in red
+func (diag *Diagnosis) Annotate(img *image.NRGBA) *image.NRGBA {
+	out := imaging.Clone(img)
+
+	width := maxInt(minInt(img.Bounds().Dx(), img.Bounds().Dy())/300, 1)
+	for _, det := range diag.Faces {
+		strokeRect(out, DetectionRect(det), annotateFaceColor, width)
+	}
+	if diag.Face == nil {
+		return out
+	}
+
+	strokeRect(out, DetectionRect(diag.Face.Bounds), annotateChosenColor, width)
+	radius := maxInt(diag.Face.Bounds.Scale/20, 2*width)
+	for _, eye := range []*pigo.Puploc{diag.Face.LeftEye, diag.Face.RightEye} {
+		if eye != nil && eye.Row > 0 && eye.Col > 0 {
+			strokeCircle(out, image.Pt(eye.Col, eye.Row), radius, annotatePupilColor, width)
+		}
+	}
+
+	return out
+}
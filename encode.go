@@ -0,0 +1,221 @@
+package facedetect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrFileSizeExceeded  = errors.New("portrait can't be encoded within the maximum file size")
+)
+
+// Format is the image format a portrait is written in
+type Format string
+
+const (
+	// FormatAuto uses the format matching the output path's extension
+	FormatAuto Format = ""
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatBMP  Format = "bmp"
+	FormatTIFF Format = "tiff"
+)
+
+var formatInfo = map[Format]struct {
+	ext    string
+	format imaging.Format
+}{
+	FormatJPEG: {".jpg", imaging.JPEG},
+	FormatPNG:  {".png", imaging.PNG},
+	FormatGIF:  {".gif", imaging.GIF},
+	FormatBMP:  {".bmp", imaging.BMP},
+	FormatTIFF: {".tif", imaging.TIFF},
+}
+
+// FormatFromPath returns the Format matching path's extension
+func FormatFromPath(path string) (Format, error) {
+	f, err := imaging.FormatFromFilename(path)
+	if err != nil {
+		return FormatAuto, fmt.Errorf("%w: %s", ErrUnsupportedFormat, filepath.Ext(path))
+	}
+	return Format(strings.ToLower(f.String())), nil
+}
+
+// OutputFormat returns the format the portrait will be written in when written to path.
+// Masked portraits are always written as PNG to preserve transparency.
+// If c.MaxFileSize is set and c.Format is FormatAuto, portraits are written as JPEG
+func (c *PortraitConfig) OutputFormat(path string) (Format, error) {
+	if c.Mask != MaskNone {
+		return FormatPNG, nil
+	}
+	if c.Format != FormatAuto {
+		if _, ok := formatInfo[c.Format]; !ok {
+			return FormatAuto, fmt.Errorf("%w: %s", ErrUnsupportedFormat, c.Format)
+		}
+		return c.Format, nil
+	}
+	if c.MaxFileSize > 0 {
+		return FormatJPEG, nil
+	}
+	return FormatFromPath(path)
+}
+
+// OutputPath returns path with its extension changed to match the format the portrait will be written in.
+// If the extension already matches the format (e.g. .jpeg for FormatJPEG), it is kept
+func (c *PortraitConfig) OutputPath(path string) string {
+	format, err := c.OutputFormat(path)
+	if err != nil {
+		return path
+	}
+	if f, err := FormatFromPath(path); err == nil && f == format {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + formatInfo[format].ext
+}
+
+// EncodeResult describes an encoded portrait
+type EncodeResult struct {
+	Format Format
+	// Quality is the JPEG quality used, or 0 for other formats
+	Quality int
+	Width   int
+	Height  int
+	Size    int64
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// encode writes img to w in format using the encoder settings in c, overriding the JPEG quality with quality
+func (c *PortraitConfig) encode(w io.Writer, img image.Image, format Format, quality int) (*EncodeResult, error) {
+	info, ok := formatInfo[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	res := &EncodeResult{Format: format, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	opts := []imaging.EncodeOption{imaging.PNGCompressionLevel(c.PNGCompression)}
+	if format == FormatJPEG {
+		if quality <= 0 {
+			quality = 95
+		}
+		res.Quality = quality
+		opts = append(opts, imaging.JPEGQuality(quality))
+	}
+
+	cw := &countingWriter{w: w}
+	if err := imaging.Encode(cw, img, info.format, opts...); err != nil {
+		return nil, err
+	}
+	res.Size = cw.n
+
+	return res, nil
+}
+
+// encodeBudget encodes img in format with the highest JPEG quality between c.MinJPEGQuality and c.JPEGQuality
+// that fits in c.MaxFileSize bytes. If no quality fits and c.AllowDownscale is set, img is downscaled by 10% until it fits
+func (c *PortraitConfig) encodeBudget(img image.Image, format Format) (*bytes.Buffer, *EncodeResult, error) {
+	maxQuality := c.JPEGQuality
+	if maxQuality <= 0 || maxQuality > 100 {
+		maxQuality = 95
+	}
+	minQuality := c.MinJPEGQuality
+	if minQuality <= 0 || minQuality > maxQuality {
+		minQuality = 1
+	}
+	if format != FormatJPEG {
+		minQuality = maxQuality
+	}
+
+	for {
+		// binary search for the highest quality that fits
+		var (
+			best    *bytes.Buffer
+			bestRes *EncodeResult
+		)
+		lo, hi := minQuality, maxQuality
+		for lo <= hi {
+			q := (lo + hi) / 2
+			buf := new(bytes.Buffer)
+			res, err := c.encode(buf, img, format, q)
+			if err != nil {
+				return nil, nil, err
+			}
+			if res.Size <= c.MaxFileSize {
+				best, bestRes = buf, res
+				lo = q + 1
+			} else {
+				hi = q - 1
+			}
+		}
+		if best != nil {
+			return best, bestRes, nil
+		}
+
+		width := img.Bounds().Dx() * 9 / 10
+		if !c.AllowDownscale || width < 16 {
+			return nil, nil, fmt.Errorf("%w: %d bytes", ErrFileSizeExceeded, c.MaxFileSize)
+		}
+		img = imaging.Resize(img, width, 0, imaging.Lanczos)
+	}
+}
+
+// Encode writes img to w in format using the encoder settings in c.
+// If c.MaxFileSize is set, the highest JPEG quality between c.MinJPEGQuality and c.JPEGQuality that fits is used,
+// downscaling the portrait if c.AllowDownscale is set and no quality fits.
+// Other formats can only be fit by downscaling. ErrFileSizeExceeded is returned if the portrait can't fit
+func (c *PortraitConfig) Encode(w io.Writer, img image.Image, format Format) (*EncodeResult, error) {
+	if c.MaxFileSize <= 0 {
+		return c.encode(w, img, format, c.JPEGQuality)
+	}
+
+	buf, res, err := c.encodeBudget(img, format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = buf.WriteTo(w); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Save writes img to c.OutputPath(path) in the format returned by c.OutputFormat
+func (c *PortraitConfig) Save(img image.Image, path string) (*EncodeResult, error) {
+	format, err := c.OutputFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// encode before creating the file so encoding errors don't leave an empty file
+	buf := new(bytes.Buffer)
+	res, err := c.Encode(buf, img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(c.OutputPath(path), buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("could not write file: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package facedetect
+
+import (
+	"errors"
+	"image"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// noiseImage returns a w x h image of random pixels, which compresses poorly
+func noiseImage(w, h int) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func TestEncodeBudget(t *testing.T) {
+	img := noiseImage(200, 200)
+	sizes := make(map[int]int64)
+	for _, q := range []int{40, 60, 61, 80, 90} {
+		res, err := (&PortraitConfig{}).encode(io.Discard, img, FormatJPEG, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[q] = res.Size
+	}
+
+	tests := []struct {
+		name        string
+		config      PortraitConfig
+		wantQuality int
+		wantErr     error
+	}{
+		{"max quality fits", PortraitConfig{JPEGQuality: 80, MinJPEGQuality: 40, MaxFileSize: sizes[80]}, 80, nil},
+		{"highest quality that fits", PortraitConfig{JPEGQuality: 90, MinJPEGQuality: 40, MaxFileSize: sizes[61] - 1}, 60, nil},
+		{"min quality fits", PortraitConfig{JPEGQuality: 90, MinJPEGQuality: 40, MaxFileSize: sizes[40]}, 40, nil},
+		{"nothing fits", PortraitConfig{JPEGQuality: 90, MinJPEGQuality: 40, MaxFileSize: sizes[40] - 1}, 0, ErrFileSizeExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf, res, err := test.config.encodeBudget(img, FormatJPEG)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if res.Quality != test.wantQuality {
+				t.Errorf("quality = %d, want %d", res.Quality, test.wantQuality)
+			}
+			if res.Size > test.config.MaxFileSize || int64(buf.Len()) != res.Size {
+				t.Errorf("size = %d (buffer %d), want at most %d", res.Size, buf.Len(), test.config.MaxFileSize)
+			}
+		})
+	}
+}
+
+func TestEncodeBudgetDownscale(t *testing.T) {
+	img := noiseImage(200, 200)
+	res, err := (&PortraitConfig{}).encode(io.Discard, img, FormatPNG, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &PortraitConfig{MaxFileSize: res.Size / 2}
+	if _, _, err = config.encodeBudget(img, FormatPNG); !errors.Is(err, ErrFileSizeExceeded) {
+		t.Fatalf("error = %v, want %v", err, ErrFileSizeExceeded)
+	}
+
+	config.AllowDownscale = true
+	buf, res, err := config.encodeBudget(img, FormatPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Size > config.MaxFileSize || int64(buf.Len()) != res.Size {
+		t.Errorf("size = %d (buffer %d), want at most %d", res.Size, buf.Len(), config.MaxFileSize)
+	}
+	if res.Width >= 200 || res.Width != res.Height {
+		t.Errorf("dimensions = %dx%d, want a downscaled square", res.Width, res.Height)
+	}
+	decoded, _, err := image.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds().Dx() != res.Width || decoded.Bounds().Dy() != res.Height {
+		t.Errorf("encoded image is %v, want %dx%d", decoded.Bounds(), res.Width, res.Height)
+	}
+}
@@ -0,0 +1,169 @@
+package facedetect
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+func clampUint8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// DefaultSharpenSigma is the sigma used by UnsharpMask if none is given
+const DefaultSharpenSigma = 1.0
+
+// UnsharpMask sharpens the image by adding amount times the difference between the image and a gaussian blurred copy of it.
+// sigma is the standard deviation of the gaussian blur; larger values sharpen coarser detail.
+// If sigma is 0 or less, DefaultSharpenSigma is used
+func UnsharpMask(img image.Image, amount, sigma float64) *image.NRGBA {
+	src := imaging.Clone(img)
+	if amount <= 0 {
+		return src
+	}
+	if sigma <= 0 {
+		sigma = DefaultSharpenSigma
+	}
+
+	blurred := imaging.Blur(src, sigma)
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			v := float64(src.Pix[i+c])
+			src.Pix[i+c] = clampUint8(v + amount*(v-float64(blurred.Pix[i+c])))
+		}
+	}
+
+	return src
+}
+
+// median returns the median value of the count values in hist
+func median(hist *[256]int, count int) uint8 {
+	half := count / 2
+	sum := 0
+	for v := 0; v < 256; v++ {
+		sum += hist[v]
+		if sum > half {
+			return uint8(v)
+		}
+	}
+	return 255
+}
+
+// Denoise removes noise from the image with an edge preserving median filter.
+// radius is the distance in pixels from the center of the filter window to its edge
+func Denoise(img image.Image, radius int) *image.NRGBA {
+	src := imaging.Clone(img)
+	if radius < 1 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		var hist [3][256]int
+		count := 0
+		y0, y1 := maxInt(0, y-radius), minInt(h-1, y+radius)
+
+		// add or remove column x of the window from the histograms
+		update := func(x, delta int) {
+			for yy := y0; yy <= y1; yy++ {
+				i := yy*src.Stride + x*4
+				hist[0][src.Pix[i]] += delta
+				hist[1][src.Pix[i+1]] += delta
+				hist[2][src.Pix[i+2]] += delta
+			}
+			count += delta * (y1 - y0 + 1)
+		}
+
+		for x := 0; x <= minInt(w-1, radius); x++ {
+			update(x, 1)
+		}
+
+		for x := 0; x < w; x++ {
+			if x > 0 {
+				if x-radius-1 >= 0 {
+					update(x-radius-1, -1)
+				}
+				if x+radius < w {
+					update(x+radius, 1)
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = median(&hist[0], count)
+			dst.Pix[i+1] = median(&hist[1], count)
+			dst.Pix[i+2] = median(&hist[2], count)
+			dst.Pix[i+3] = src.Pix[i+3]
+		}
+	}
+
+	return dst
+}
+
+// Equalize spreads the brightness of the image across the full range with histogram equalization of its luma,
+// which can help detection in under or over exposed images. Hue is preserved by scaling each pixel's channels equally
+func Equalize(img image.Image) *image.NRGBA {
+	src := imaging.Clone(img)
+
+	w := DefaultGrayscaleWeights
+	luma := func(i int) uint8 {
+		return clampUint8(w[0]*float64(src.Pix[i]) + w[1]*float64(src.Pix[i+1]) + w[2]*float64(src.Pix[i+2]))
+	}
+
+	var hist [256]int
+	for i := 0; i < len(src.Pix); i += 4 {
+		hist[luma(i)]++
+	}
+
+	// map each luma to its position in the cumulative distribution
+	var cdf [256]int
+	sum, minCDF := 0, 0
+	for v := 0; v < 256; v++ {
+		sum += hist[v]
+		cdf[v] = sum
+		if minCDF == 0 {
+			minCDF = sum
+		}
+	}
+	total := len(src.Pix) / 4
+	if total == minCDF {
+		return src
+	}
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		y := luma(i)
+		mapped := float64(cdf[y]-minCDF) / float64(total-minCDF) * 255
+		if y == 0 {
+			v := clampUint8(mapped)
+			src.Pix[i], src.Pix[i+1], src.Pix[i+2] = v, v, v
+			continue
+		}
+		scale := mapped / float64(y)
+		for c := 0; c < 3; c++ {
+			src.Pix[i+c] = clampUint8(float64(src.Pix[i+c]) * scale)
+		}
+	}
+
+	return src
+}
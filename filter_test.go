@@ -0,0 +1,123 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// grayImage returns a w x h opaque image with each pixel's gray level set by level
+func grayImage(w, h int, level func(x, y int) uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := level(x, y)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 0xff})
+		}
+	}
+	return img
+}
+
+// edge returns the level of a vertical edge from dark to light gray at x = 5
+func edge(x, _ int) uint8 {
+	if x < 5 {
+		return 0x40
+	}
+	return 0xc0
+}
+
+func TestDenoise(t *testing.T) {
+	noisy := grayImage(9, 9, func(x, y int) uint8 {
+		if x == 4 && y == 4 {
+			return 0xff
+		}
+		return 0x80
+	})
+	orig := append([]uint8(nil), noisy.Pix...)
+
+	if c := Denoise(noisy, 1).NRGBAAt(4, 4); c != (color.NRGBA{0x80, 0x80, 0x80, 0xff}) {
+		t.Errorf("noisy pixel = %v, want it removed", c)
+	}
+	if string(noisy.Pix) != string(orig) {
+		t.Error("source image was modified")
+	}
+	if c := Denoise(noisy, 0).NRGBAAt(4, 4); c.R != 0xff {
+		t.Errorf("radius 0: noisy pixel = %v, want unchanged", c)
+	}
+
+	edged := grayImage(10, 10, edge)
+	if denoised := Denoise(edged, 2); string(denoised.Pix) != string(edged.Pix) {
+		t.Error("edge wasn't preserved")
+	}
+}
+
+func TestUnsharpMask(t *testing.T) {
+	flat := grayImage(10, 10, func(_, _ int) uint8 { return 0x80 })
+	if sharpened := UnsharpMask(flat, 2, 1); string(sharpened.Pix) != string(flat.Pix) {
+		t.Error("flat image was changed")
+	}
+
+	edged := grayImage(10, 10, edge)
+	orig := append([]uint8(nil), edged.Pix...)
+	sharpened := UnsharpMask(edged, 2, 1)
+	if string(edged.Pix) != string(orig) {
+		t.Error("source image was modified")
+	}
+	if dark, bright := sharpened.NRGBAAt(4, 5), sharpened.NRGBAAt(5, 5); dark.R >= 0x40 || bright.R <= 0xc0 {
+		t.Errorf("edge pixels = %v, %v, want more contrast than %#x, %#x", dark, bright, 0x40, 0xc0)
+	}
+	if far := sharpened.NRGBAAt(0, 5); far.R != 0x40 {
+		t.Errorf("pixel away from the edge = %v, want unchanged", far)
+	}
+
+	if unchanged := UnsharpMask(edged, 0, 1); string(unchanged.Pix) != string(edged.Pix) {
+		t.Error("amount 0 changed the image")
+	}
+	if defaulted := UnsharpMask(edged, 2, 0); string(defaulted.Pix) != string(UnsharpMask(edged, 2, DefaultSharpenSigma).Pix) {
+		t.Error("sigma 0 didn't use DefaultSharpenSigma")
+	}
+}
+
+func TestEqualize(t *testing.T) {
+	// a dim ramp from gray 100 to 119 with a reddish tint
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 1))
+	for x := 0; x < 20; x++ {
+		v := uint8(100 + x)
+		img.SetNRGBA(x, 0, color.NRGBA{v + 20, v, v, 0xff})
+	}
+	orig := append([]uint8(nil), img.Pix...)
+
+	eq := Equalize(img)
+	if string(img.Pix) != string(orig) {
+		t.Error("source image was modified")
+	}
+	if c := eq.NRGBAAt(0, 0); c.R != 0 || c.G != 0 || c.B != 0 {
+		t.Errorf("darkest pixel = %v, want black", c)
+	}
+	last := eq.NRGBAAt(19, 0)
+	if last.G < 240 {
+		t.Errorf("brightest pixel = %v, want near white", last)
+	}
+	for x := 1; x < 20; x++ {
+		c, prev := eq.NRGBAAt(x, 0), eq.NRGBAAt(x-1, 0)
+		if c.G < prev.G {
+			t.Errorf("pixel %d (%v) is darker than pixel %d (%v)", x, c, x-1, prev)
+		}
+		if c.G > 0 && c.R <= c.G {
+			t.Errorf("pixel %d = %v, want tint preserved", x, c)
+		}
+		if c.A != 0xff {
+			t.Errorf("pixel %d alpha = %d, want 255", x, c.A)
+		}
+	}
+}
+
+func TestEqualizeUniform(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	if eq := Equalize(img); string(eq.Pix) != string(img.Pix) {
+		t.Errorf("uniform image changed to %v", eq.Pix[:4])
+	}
+}
@@ -0,0 +1,89 @@
+package facedetect
+
+import (
+	"image"
+	"math"
+)
+
+// EstimateCrown estimates the row of the top of the head, including hair or a hat, above the detected face.
+// It samples the background beside the head, then scans upward from the top of the face for the first rows
+// that no longer differ from the background. The search is limited to one face height above the face.
+// If no background can be sampled, the crown is estimated from the face size
+func EstimateCrown(img *image.NRGBA, face *Face) int {
+	b := img.Bounds()
+	s := face.Bounds.Scale
+	faceTop := face.Bounds.Row - s/2
+	limit := maxInt(b.Min.Y, faceTop-s)
+	fallback := maxInt(b.Min.Y, faceTop-s/4)
+	if faceTop <= b.Min.Y {
+		return maxInt(b.Min.Y, faceTop)
+	}
+
+	// sample the background beside the head
+	var (
+		sum, sumSq [3]float64
+		n          float64
+	)
+	for y := limit; y < faceTop; y++ {
+		for _, x0 := range []int{face.Bounds.Col - s*95/100, face.Bounds.Col + s*85/100} {
+			for x := x0; x < x0+s/10; x++ {
+				if !image.Pt(x, y).In(b) {
+					continue
+				}
+				i := img.PixOffset(x, y)
+				if img.Pix[i+3] == 0 {
+					continue
+				}
+				for c := 0; c < 3; c++ {
+					v := float64(img.Pix[i+c])
+					sum[c] += v
+					sumSq[c] += v * v
+				}
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return fallback
+	}
+
+	var mean [3]float64
+	variance := 0.0
+	for c := 0; c < 3; c++ {
+		mean[c] = sum[c] / n
+		variance += sumSq[c]/n - mean[c]*mean[c]
+	}
+	threshold := math.Max(30, 2.5*math.Sqrt(math.Max(0, variance)))
+
+	// scan upward for the boundary between the head and the background
+	crown := faceTop
+	gap := 0
+	maxGap := maxInt(1, s/20)
+	x0, x1 := maxInt(b.Min.X, face.Bounds.Col-s/4), minInt(b.Max.X, face.Bounds.Col+s/4)
+	for y := faceTop; y >= limit; y-- {
+		head, opaque := 0, 0
+		for x := x0; x < x1; x++ {
+			i := img.PixOffset(x, y)
+			if img.Pix[i+3] == 0 {
+				continue
+			}
+			opaque++
+			dr, dg, db := float64(img.Pix[i])-mean[0], float64(img.Pix[i+1])-mean[1], float64(img.Pix[i+2])-mean[2]
+			if math.Sqrt(dr*dr+dg*dg+db*db) > threshold {
+				head++
+			}
+		}
+		if opaque == 0 {
+			break
+		}
+
+		if head*2 >= opaque {
+			crown = y
+			gap = 0
+		} else if gap++; gap > maxGap {
+			break
+		}
+	}
+
+	return crown
+}
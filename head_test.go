@@ -0,0 +1,88 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// headImage returns a 200 x 200 gray image with a dark head of hair from row hairTop down to a face centered at 100, 100
+// with a scale of 60. Pixels left of x are made transparent
+func headImage(hairTop, transparentX int) (*image.NRGBA, *Face) {
+	img := grayImage(200, 200, func(x, y int) uint8 {
+		dx := float64(x-100) / 35
+		if y >= hairTop && y < 100 && dx*dx <= 1 {
+			return 0x20
+		}
+		return 0xb0
+	})
+	for y := 0; y < 200; y++ {
+		for x := 0; x < transparentX; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{})
+		}
+	}
+	return img, &Face{Bounds: pigo.Detection{Row: 100, Col: 100, Scale: 60}}
+}
+
+func TestEstimateCrown(t *testing.T) {
+	tests := []struct {
+		name         string
+		hairTop      int
+		transparentX int
+		row          int
+		want         int
+	}{
+		{"hair", 50, 0, 100, 50},
+		{"no hair", 100, 0, 100, 70},
+		{"hair above search limit", 0, 0, 100, 10},
+		{"transparent background", 50, 200, 100, 55},
+		{"face at top of image", 0, 0, 20, 0},
+	}
+
+	for _, test := range tests {
+		img, face := headImage(test.hairTop, test.transparentX)
+		face.Bounds.Row = test.row
+		if got := EstimateCrown(img, face); got < test.want-1 || got > test.want+1 {
+			t.Errorf("%s: crown = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCropRectHeadroom(t *testing.T) {
+	img := grayImage(400, 400, func(_, _ int) uint8 { return 0x80 })
+	face := &Face{
+		Bounds:   pigo.Detection{Row: 200, Col: 200, Scale: 80},
+		LeftEye:  &pigo.Puploc{Row: 190, Col: 185},
+		RightEye: &pigo.Puploc{Row: 190, Col: 215},
+	}
+
+	tests := []struct {
+		name     string
+		crown    int
+		headroom float64
+		want     image.Rectangle
+	}{
+		{"headroom", 150, 0.1, image.Rect(140, 134, 260, 294)},
+		{"no headroom", 150, 0, image.Rect(140, 150, 260, 310)},
+	}
+	for _, test := range tests {
+		if got := CropRectHeadroom(img, face, test.crown, 0.75, 1.5, test.headroom); got != test.want {
+			t.Errorf("%s: crop = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// the crop shrinks to stay inside the image when the headroom doesn't fit above the crown
+	crown, headroom := 30, 0.25
+	crop := CropRectHeadroom(img, face, crown, 0.75, 1.5, headroom)
+	if crop.Min.Y < 0 {
+		t.Errorf("crop %v extends above the image", crop)
+	}
+	if crop.Dx() < face.Bounds.Scale || crop.Dx() >= 120 {
+		t.Errorf("crop width = %d, want between %d and 120", crop.Dx(), face.Bounds.Scale)
+	}
+	if want := crown - int(headroom*float64(crop.Dy())); crop.Min.Y < want-1 || crop.Min.Y > want+1 {
+		t.Errorf("crop top = %d, want %d", crop.Min.Y, want)
+	}
+}
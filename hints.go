@@ -0,0 +1,165 @@
+package facedetect
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// Hints are manual corrections used in place of detection when framing a portrait.
+// Coordinates are in pixels of the image being framed.
+// If Face is set, face detection is skipped. If both eyes are set, pupil detection is skipped,
+// and if no face is detected, the face is estimated from the eyes.
+// If Rotation is set, the image is rotated Rotation degrees counter-clockwise instead of leveling the pupils
+type Hints struct {
+	Face     *image.Rectangle
+	LeftEye  *image.Point
+	RightEye *image.Point
+	Rotation *float64
+}
+
+// Located returns true if h sets the position of the face or either eye
+func (h *Hints) Located() bool {
+	return h.Face != nil || h.LeftEye != nil || h.RightEye != nil
+}
+
+// rectDetection returns a detection covering r
+func rectDetection(r image.Rectangle) pigo.Detection {
+	c := r.Min.Add(r.Max).Div(2)
+	return pigo.Detection{Row: c.Y, Col: c.X, Scale: maxInt(r.Dx(), r.Dy())}
+}
+
+// eyesDetection returns the face detection whose pupils DetectPupils would search for at left and right
+func eyesDetection(left, right image.Point) pigo.Detection {
+	dist := math.Hypot(float64(right.X-left.X), float64(right.Y-left.Y))
+	scale := dist / (2 * 0.185)
+	c := left.Add(right).Div(2)
+	return pigo.Detection{Row: c.Y + int(0.085*scale), Col: c.X, Scale: int(scale)}
+}
+
+// pointPuploc returns a pupil at p for face
+func pointPuploc(p image.Point, face pigo.Detection) *pigo.Puploc {
+	return &pigo.Puploc{Row: p.Y, Col: p.X, Scale: float32(face.Scale) * 0.4}
+}
+
+// ErrInvalidFace is returned for face geometry that can't frame an upright portrait
+var ErrInvalidFace = errors.New("invalid face")
+
+// validateEyes returns an error if left and right are the same point, or left isn't to the left of right
+func validateEyes(left, right image.Point) error {
+	if left == right {
+		return fmt.Errorf("%w: both eyes are at %v", ErrInvalidFace, left)
+	}
+	if left.X >= right.X {
+		return fmt.Errorf("%w: left eye %v isn't left of right eye %v", ErrInvalidFace, left, right)
+	}
+	return nil
+}
+
+// validateEyeInside returns an error if the eye (named by side) isn't inside bounds
+func validateEyeInside(side string, eye image.Point, bounds image.Rectangle) error {
+	if !eye.In(bounds) {
+		return fmt.Errorf("%w: %s eye %v is outside the image %v", ErrInvalidFace, side, eye, bounds)
+	}
+	return nil
+}
+
+// NewFace returns a Face with pupils at the given points, e.g. where a user clicked on the eyes.
+// leftEye is the pupil on the left side of the image. The face bounds are estimated from the distance between the pupils.
+// ErrInvalidFace is returned if the pupils are at the same point or leftEye isn't left of rightEye
+func NewFace(leftEye, rightEye image.Point) (*Face, error) {
+	if err := validateEyes(leftEye, rightEye); err != nil {
+		return nil, err
+	}
+	bounds := eyesDetection(leftEye, rightEye)
+	return &Face{Bounds: bounds, LeftEye: pointPuploc(leftEye, bounds), RightEye: pointPuploc(rightEye, bounds)}, nil
+}
+
+// NewFaceWithBounds returns a Face with the given bounding box and pupils.
+// leftEye is the pupil on the left side of the image.
+// ErrInvalidFace is returned if bounds is empty, the pupils are at the same point, or leftEye isn't left of rightEye
+func NewFaceWithBounds(bounds image.Rectangle, leftEye, rightEye image.Point) (*Face, error) {
+	if bounds.Empty() {
+		return nil, fmt.Errorf("%w: empty bounds %v", ErrInvalidFace, bounds)
+	}
+	if err := validateEyes(leftEye, rightEye); err != nil {
+		return nil, err
+	}
+	det := rectDetection(bounds)
+	return &Face{Bounds: det, LeftEye: pointPuploc(leftEye, det), RightEye: pointPuploc(rightEye, det)}, nil
+}
+
+// detectFaceWithHints detects a single face and pupils in img like detectFace, using the positions given in hints
+func (d *Detector) detectFaceWithHints(img *image.NRGBA, hints *Hints) (*Face, []pigo.Detection, error) {
+	if !hints.Located() {
+		return d.detectFace(img, 0)
+	}
+	if hints.LeftEye != nil {
+		if err := validateEyeInside("left", *hints.LeftEye, img.Bounds()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hints.RightEye != nil {
+		if err := validateEyeInside("right", *hints.RightEye, img.Bounds()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hints.LeftEye != nil && hints.RightEye != nil {
+		if err := validateEyes(*hints.LeftEye, *hints.RightEye); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	params := imageParams(img)
+	face := new(Face)
+	var faces []pigo.Detection
+	switch {
+	case hints.Face != nil:
+		face.Bounds = rectDetection(*hints.Face)
+		faces = []pigo.Detection{face.Bounds}
+	default:
+		if faces = d.detectAllFaces(params, 0); len(faces) > 0 {
+			face.Bounds = ChooseBestFace(faces)
+		} else if hints.LeftEye != nil && hints.RightEye != nil {
+			face.Bounds = eyesDetection(*hints.LeftEye, *hints.RightEye)
+		} else {
+			return nil, faces, ErrFaceUndetected
+		}
+	}
+
+	if hints.LeftEye == nil || hints.RightEye == nil {
+		face.LeftEye, face.RightEye = d.DetectPupils(params, face.Bounds, 0)
+	}
+	if hints.LeftEye != nil {
+		face.LeftEye = pointPuploc(*hints.LeftEye, face.Bounds)
+	}
+	if hints.RightEye != nil {
+		face.RightEye = pointPuploc(*hints.RightEye, face.Bounds)
+	}
+
+	if !face.PupilsDetected() {
+		return face, faces, ErrPupilsUndetected
+	}
+
+	return face, faces, nil
+}
+
+// rotateFace returns face moved to its position after an image with bounds src is rotated angle degrees counter-clockwise
+// into an image with bounds dst
+func rotateFace(face *Face, angle float64, src, dst image.Rectangle) *Face {
+	rotated := &Face{Bounds: face.Bounds}
+	c := rotatePoint(image.Pt(face.Bounds.Col, face.Bounds.Row), angle, src, dst)
+	rotated.Bounds.Col, rotated.Bounds.Row = c.X, c.Y
+
+	for _, eye := range []struct{ src, dst **pigo.Puploc }{{&face.LeftEye, &rotated.LeftEye}, {&face.RightEye, &rotated.RightEye}} {
+		p := **eye.src
+		c := rotatePoint(image.Pt(p.Col, p.Row), angle, src, dst)
+		p.Col, p.Row = c.X, c.Y
+		*eye.dst = &p
+	}
+
+	return rotated
+}
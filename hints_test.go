@@ -0,0 +1,116 @@
+package facedetect
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestNewFace(t *testing.T) {
+	tests := []struct {
+		name        string
+		bounds      image.Rectangle
+		left, right image.Point
+		valid       bool
+	}{
+		{"level", image.Rect(0, 0, 100, 100), image.Pt(30, 40), image.Pt(70, 40), true},
+		{"tilted", image.Rect(0, 0, 100, 100), image.Pt(30, 50), image.Pt(70, 30), true},
+		{"same point", image.Rect(0, 0, 100, 100), image.Pt(50, 40), image.Pt(50, 40), false},
+		{"swapped", image.Rect(0, 0, 100, 100), image.Pt(70, 40), image.Pt(30, 40), false},
+		{"vertical", image.Rect(0, 0, 100, 100), image.Pt(50, 20), image.Pt(50, 60), false},
+		{"empty bounds", image.Rectangle{}, image.Pt(30, 40), image.Pt(70, 40), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			face, err := NewFaceWithBounds(test.bounds, test.left, test.right)
+			if test.valid != (err == nil) {
+				t.Fatalf("NewFaceWithBounds error = %v, want valid %t", err, test.valid)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidFace) {
+				t.Errorf("NewFaceWithBounds error = %v, want %v", err, ErrInvalidFace)
+			}
+			if err == nil && (face.LeftEye.Col != test.left.X || face.LeftEye.Row != test.left.Y) {
+				t.Errorf("left eye = %v, want %v", face.LeftEye, test.left)
+			}
+
+			if test.bounds.Empty() {
+				return
+			}
+			face, err = NewFace(test.left, test.right)
+			if test.valid != (err == nil) {
+				t.Fatalf("NewFace error = %v, want valid %t", err, test.valid)
+			}
+			if err == nil && face.Bounds.Scale <= 0 {
+				t.Errorf("face scale = %d, want > 0", face.Bounds.Scale)
+			}
+		})
+	}
+}
+
+func TestFrameFaceInvalid(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	valid, err := NewFace(image.Pt(80, 90), image.Pt(120, 90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := &Face{Bounds: valid.Bounds, LeftEye: valid.RightEye, RightEye: valid.LeftEye}
+	same := &Face{Bounds: valid.Bounds, LeftEye: valid.LeftEye, RightEye: valid.LeftEye}
+
+	outside, err := NewFace(image.Pt(80, 400), image.Pt(120, 400))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, face := range map[string]*Face{"nil": nil, "swapped": swapped, "same point": same, "outside": outside} {
+		if _, err := FrameFace(img, face, nil); !errors.Is(err, ErrInvalidFace) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrInvalidFace)
+		}
+	}
+	if _, err := FrameFace(img, &Face{Bounds: valid.Bounds}, nil); !errors.Is(err, ErrPupilsUndetected) {
+		t.Errorf("no pupils: error = %v, want %v", err, ErrPupilsUndetected)
+	}
+	if _, err := FrameFace(img, valid, nil); err != nil {
+		t.Errorf("valid face: %v", err)
+	}
+}
+
+func TestFrameWithHintsInvalid(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	for name, eyes := range map[string][2]image.Point{
+		"swapped":      {image.Pt(120, 90), image.Pt(80, 90)},
+		"outside":      {image.Pt(80, 400), image.Pt(120, 400)},
+		"left outside": {image.Pt(-10, 90), image.Pt(120, 90)},
+	} {
+		left, right := eyes[0], eyes[1]
+		if _, err := new(Detector).FrameWithHints(img, nil, &Hints{LeftEye: &left, RightEye: &right}); !errors.Is(err, ErrInvalidFace) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrInvalidFace)
+		}
+	}
+	right := image.Pt(250, 90)
+	if _, err := new(Detector).FrameWithHints(img, nil, &Hints{RightEye: &right}); !errors.Is(err, ErrInvalidFace) {
+		t.Errorf("right eye outside: error = %v, want %v", err, ErrInvalidFace)
+	}
+}
+
+func TestRotatePoint(t *testing.T) {
+	src := image.Rect(0, 0, 100, 50)
+	tests := []struct {
+		angle float64
+		dst   image.Rectangle
+		p     image.Point
+		want  image.Point
+	}{
+		{0, src, image.Pt(10, 20), image.Pt(10, 20)},
+		{180, src, image.Pt(10, 20), image.Pt(89, 29)},
+		{90, image.Rect(0, 0, 50, 100), image.Pt(10, 20), image.Pt(20, 89)},
+		{-90, image.Rect(0, 0, 50, 100), image.Pt(10, 20), image.Pt(29, 10)},
+		{90, image.Rect(0, 0, 50, 100), image.Pt(99, 0), image.Pt(0, 0)},
+	}
+
+	for _, test := range tests {
+		if got := rotatePoint(test.p, test.angle, src, test.dst); got != test.want {
+			t.Errorf("rotatePoint(%v, %v) = %v, want %v", test.p, test.angle, got, test.want)
+		}
+	}
+}
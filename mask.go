@@ -0,0 +1,77 @@
+package facedetect
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Mask is the shape of the transparent mask applied to a portrait
+type Mask string
+
+const (
+	MaskNone        Mask = ""
+	MaskCircle      Mask = "circle"
+	MaskRoundedRect Mask = "rounded"
+	MaskEllipse     Mask = "ellipse"
+)
+
+// maskSamples is the number of samples taken per pixel in each dimension to anti-alias mask edges
+const maskSamples = 4
+
+// insideFunc returns a function that reports whether the point x, y is inside the mask for an image of size width, height
+func (m Mask) insideFunc(width, height int, radius float64) func(x, y float64) bool {
+	w, h := float64(width), float64(height)
+	switch m {
+	case MaskCircle:
+		r := math.Min(w, h) / 2
+		return func(x, y float64) bool {
+			dx, dy := x-w/2, y-h/2
+			return dx*dx+dy*dy <= r*r
+		}
+	case MaskEllipse:
+		return func(x, y float64) bool {
+			dx, dy := (x-w/2)/(w/2), (y-h/2)/(h/2)
+			return dx*dx+dy*dy <= 1
+		}
+	case MaskRoundedRect:
+		r := math.Max(0, math.Min(radius, 0.5)) * math.Min(w, h)
+		return func(x, y float64) bool {
+			// distance from the point to the rectangle inset by r
+			dx := math.Max(0, math.Max(r-x, x-(w-r)))
+			dy := math.Max(0, math.Max(r-y, y-(h-r)))
+			return dx*dx+dy*dy <= r*r
+		}
+	}
+	return nil
+}
+
+// ApplyMask makes the area of the image outside of mask transparent, anti-aliasing the edges of the mask.
+// radius is the corner radius of MaskRoundedRect as a ratio of the shortest side of the image (0 to 0.5)
+func ApplyMask(img image.Image, mask Mask, radius float64) *image.NRGBA {
+	dst := imaging.Clone(img)
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	inside := mask.insideFunc(w, h, radius)
+	if inside == nil {
+		return dst
+	}
+
+	const step = 1.0 / maskSamples
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			covered := 0
+			for sy := 0; sy < maskSamples; sy++ {
+				for sx := 0; sx < maskSamples; sx++ {
+					if inside(float64(x)+(float64(sx)+0.5)*step, float64(y)+(float64(sy)+0.5)*step) {
+						covered++
+					}
+				}
+			}
+			i := y*dst.Stride + x*4 + 3
+			dst.Pix[i] = uint8(int(dst.Pix[i]) * covered / (maskSamples * maskSamples))
+		}
+	}
+
+	return dst
+}
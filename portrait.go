@@ -3,58 +3,288 @@ package facedetect
 import (
 	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"math"
 
 	"github.com/disintegration/imaging"
 	pigo "github.com/esimov/pigo/core"
 )
 
 type PortraitConfig struct {
-	AspectRatio   float64
-	MaxWidthRatio float64
-	Brightness    float64
-	Contrast      float64
-	Gamma         float64
+	Name              string
+	AspectRatio       float64
+	MaxWidthRatio     float64
+	Headroom          float64
+	Brightness        float64
+	Contrast          float64
+	Gamma             float64
+	Denoise           int
+	Sharpen           float64
+	SharpenSigma      float64
+	Style             Style
+	GrayscaleWeights  [3]float64
+	DuotoneShadow     color.NRGBA
+	DuotoneHighlight  color.NRGBA
+	ReplaceBackground bool
+	BackgroundColor   color.NRGBA
+	BackgroundFeather float64
+	Mask              Mask
+	MaskRadius        float64
+	Format            Format
+	JPEGQuality       int
+	PNGCompression    png.CompressionLevel
+	MaxFileSize       int64
+	MinJPEGQuality    int
+	AllowDownscale    bool
 }
 
 var DefaultPortraitConfig = &PortraitConfig{
-	AspectRatio:   3.0 / 4.0,
-	MaxWidthRatio: 1.5,
-	Brightness:    0,
-	Contrast:      5,
-	Gamma:         1.4,
+	Name:              "default",
+	AspectRatio:       3.0 / 4.0,
+	MaxWidthRatio:     1.5,
+	Headroom:          0,
+	Brightness:        0,
+	Contrast:          5,
+	Gamma:             1.4,
+	Denoise:           0,
+	Sharpen:           0,
+	SharpenSigma:      DefaultSharpenSigma,
+	Style:             StyleNone,
+	GrayscaleWeights:  DefaultGrayscaleWeights,
+	DuotoneShadow:     color.NRGBA{0, 0, 0, 255},
+	DuotoneHighlight:  color.NRGBA{255, 255, 255, 255},
+	ReplaceBackground: false,
+	BackgroundColor:   color.NRGBA{255, 255, 255, 255},
+	BackgroundFeather: 0.02,
+	Mask:              MaskNone,
+	MaskRadius:        0.1,
+	Format:            FormatAuto,
+	JPEGQuality:       95,
+	PNGCompression:    png.DefaultCompression,
+	MaxFileSize:       0,
+	MinJPEGQuality:    50,
+	AllowDownscale:    false,
 }
 
-// Portrait detects a single face in an image, rotates, crops, and brightens it, and returns the result.
+// Framing describes how a portrait is framed in an image before it is rendered.
+// Faces contains every face detected in the image, and Face is the chosen face with its pupils.
+// Angle is the counter-clockwise rotation in degrees applied to level the pupils, Rotated is the rotated image,
+// RotatedFace is the face detected in Rotated, and Crop is the bounds of the portrait in Rotated
+type Framing struct {
+	Faces       []pigo.Detection
+	Face        *Face
+	Angle       float64
+	Rotated     *image.NRGBA
+	RotatedFace *Face
+	Crop        image.Rectangle
+}
+
+// Frame detects a single face in img, rotates it, and computes the bounds of the portrait without rendering it.
+// If detection fails, the partial Framing is returned along with the error.
 // If config is nil, DefaultPortraitConfig is used
-func (d *Detector) Portrait(img *image.NRGBA, config *PortraitConfig) (*image.NRGBA, error) {
+func (d *Detector) Frame(img *image.NRGBA, config *PortraitConfig) (*Framing, error) {
+	return d.FrameWithHints(img, config, nil)
+}
+
+// FrameWithHints is like Frame, but uses the manual corrections in hints in place of detection.
+// If the face or eyes are given, the face isn't detected again after rotating.
+// ErrInvalidFace is returned if either given eye is outside img,
+// or both eyes are given and they are at the same point or LeftEye isn't left of RightEye.
+// If hints is nil, FrameWithHints is the same as Frame
+func (d *Detector) FrameWithHints(img *image.NRGBA, config *PortraitConfig, hints *Hints) (*Framing, error) {
 	if config == nil {
 		config = DefaultPortraitConfig
 	}
+	if hints == nil {
+		hints = new(Hints)
+	}
 
 	// detect face
-	face, err := d.DetectFace(img, 0)
+	var err error
+	f := new(Framing)
+	f.Face, f.Faces, err = d.detectFaceWithHints(img, hints)
 	if err != nil {
-		return nil, fmt.Errorf("could not detect face: %w", err)
+		return f, fmt.Errorf("could not detect face: %w", err)
 	}
 
 	// rotate based on pupils
-	rotated := Rotate(img, face)
+	f.Angle = RotationAngle(f.Face)
+	if hints.Rotation != nil {
+		f.Angle = *hints.Rotation
+	}
+	f.Rotated = imaging.Rotate(img, f.Angle, color.NRGBA{})
+
+	if hints.Located() {
+		// move the given face instead of detecting it again
+		f.RotatedFace = rotateFace(f.Face, f.Angle, img.Bounds(), f.Rotated.Bounds())
+	} else {
+		// detect rotated face
+		f.RotatedFace, err = d.DetectFace(f.Rotated, 0)
+		if err != nil {
+			return f, fmt.Errorf("could not detect rotated face: %w", err)
+		}
+	}
+
+	f.crop(config)
+
+	return f, nil
+}
+
+// crop sets f.Crop to the bounds of the portrait around f.RotatedFace using config
+func (f *Framing) crop(config *PortraitConfig) {
+	if config.Headroom > 0 {
+		crown := EstimateCrown(f.Rotated, f.RotatedFace)
+		f.Crop = CropRectHeadroom(f.Rotated, f.RotatedFace, crown, config.AspectRatio, config.MaxWidthRatio, config.Headroom)
+	} else {
+		f.Crop = CropRect(f.Rotated, f.RotatedFace, config.AspectRatio, config.MaxWidthRatio)
+	}
+	f.Crop = f.Crop.Intersect(f.Rotated.Bounds())
+}
+
+// Untransform returns f, which framed a copy of an image with bounds src, mapped back to the image's coordinates.
+// The copy, with bounds copied, was made by rotating the image angle degrees counter-clockwise with imaging.Rotate,
+// then scaling it by scale. Faces and Face are in the coordinates of the image, Angle is the total rotation of the image,
+// and Crop is in the coordinates of the image rotated by Angle. Rotated and RotatedFace aren't set
+func (f *Framing) Untransform(src, copied image.Rectangle, angle, scale float64) *Framing {
+	u := &Framing{Faces: make([]pigo.Detection, len(f.Faces)), Angle: angle + f.Angle}
+	u.Angle -= math.Floor((u.Angle+180)/360) * 360
+
+	// the inverse of rotating then scaling, since both are around the center
+	angle, scale = -angle, 1/scale
+	for idx, det := range f.Faces {
+		u.Faces[idx] = transformFace(&Face{Bounds: det}, angle, scale, copied, src).Bounds
+	}
+	if f.Face != nil {
+		u.Face = transformFace(f.Face, angle, scale, copied, src)
+	}
+
+	if f.Rotated != nil && !f.Crop.Empty() {
+		// Crop is the same distance from the center of the rotated copy as from the center of the rotated image, scaled
+		rotated := RotatedBounds(src, u.Angle)
+		min := transformPoint(f.Crop.Min, 0, scale, f.Rotated.Bounds(), rotated)
+		size := image.Pt(int(math.Round(float64(f.Crop.Dx())*scale)), int(math.Round(float64(f.Crop.Dy())*scale)))
+		u.Crop = image.Rectangle{Min: min, Max: min.Add(size)}.Intersect(rotated)
+	}
+
+	return u
+}
+
+// FrameFace rotates img to level the pupils of face and computes the bounds of the portrait without any detection.
+// face can come from detection or from user coordinates with NewFace or NewFaceWithBounds.
+// ErrPupilsUndetected is returned if face is missing either pupil, and ErrInvalidFace is returned if face is nil,
+// either pupil is outside img, its pupils are at the same point, or its left pupil isn't left of its right pupil.
+// If config is nil, DefaultPortraitConfig is used
+func FrameFace(img *image.NRGBA, face *Face, config *PortraitConfig) (*Framing, error) {
+	if config == nil {
+		config = DefaultPortraitConfig
+	}
+	if face == nil {
+		return nil, fmt.Errorf("%w: no face given", ErrInvalidFace)
+	}
+	if !face.PupilsDetected() {
+		return nil, ErrPupilsUndetected
+	}
+	left, right := image.Pt(face.LeftEye.Col, face.LeftEye.Row), image.Pt(face.RightEye.Col, face.RightEye.Row)
+	if err := validateEyeInside("left", left, img.Bounds()); err != nil {
+		return nil, err
+	}
+	if err := validateEyeInside("right", right, img.Bounds()); err != nil {
+		return nil, err
+	}
+	if err := validateEyes(left, right); err != nil {
+		return nil, err
+	}
+
+	f := &Framing{Faces: []pigo.Detection{face.Bounds}, Face: face, Angle: RotationAngle(face)}
+	f.Rotated = imaging.Rotate(img, f.Angle, color.NRGBA{})
+	f.RotatedFace = rotateFace(face, f.Angle, img.Bounds(), f.Rotated.Bounds())
+	f.crop(config)
+
+	return f, nil
+}
 
-	// detect rotated face
-	face, err = d.DetectFace(rotated, 0)
+// PortraitFromFace rotates, crops, and brightens img around face like Portrait, without any detection, and returns the result.
+// face can come from detection or from user coordinates with NewFace or NewFaceWithBounds.
+// Errors are returned as described in FrameFace.
+// If config is nil, DefaultPortraitConfig is used
+func PortraitFromFace(img *image.NRGBA, face *Face, config *PortraitConfig) (*image.NRGBA, error) {
+	f, err := FrameFace(img, face, config)
 	if err != nil {
-		return nil, fmt.Errorf("could not detect rotated face: %w", err)
+		return nil, err
+	}
+
+	return f.Render(config), nil
+}
+
+// Render crops and brightens the framed portrait, applying the rest of config, and returns the result.
+// If config is nil, DefaultPortraitConfig is used
+func (f *Framing) Render(config *PortraitConfig) *image.NRGBA {
+	if config == nil {
+		config = DefaultPortraitConfig
+	}
+
+	face, rect := f.RotatedFace, f.Crop
+	cropped := imaging.Crop(f.Rotated, rect)
+
+	// segment before brightening so the color models see the original image
+	var matte *image.Gray
+	if config.ReplaceBackground {
+		matte = SegmentPerson(cropped, face.Translate(rect.Min.Mul(-1)))
 	}
 
-	cropped := Crop(rotated, face, config.AspectRatio, config.MaxWidthRatio)
 	brightened := Brighten(cropped, config.Brightness, config.Contrast, config.Gamma)
 
-	return brightened, nil
+	if config.Denoise > 0 {
+		brightened = Denoise(brightened, config.Denoise)
+	}
+
+	if config.Sharpen > 0 {
+		brightened = UnsharpMask(brightened, config.Sharpen, config.SharpenSigma)
+	}
+
+	if matte != nil {
+		feather := config.BackgroundFeather * float64(face.Bounds.Scale)
+		brightened = ReplaceBackground(brightened, matte, config.BackgroundColor, feather)
+	}
+
+	if config.Style != StyleNone {
+		brightened = ApplyStyle(brightened, config.Style, config.GrayscaleWeights, config.DuotoneShadow, config.DuotoneHighlight)
+	}
+
+	if config.Mask != MaskNone {
+		brightened = ApplyMask(brightened, config.Mask, config.MaskRadius)
+	}
+
+	return brightened
+}
+
+// Portrait detects a single face in an image, rotates, crops, and brightens it, and returns the result.
+// If config.Headroom is set, the portrait is framed so the estimated top of the head is config.Headroom * the portrait height
+// below the top of the portrait instead of framing from the eyes.
+// If config.ReplaceBackground is set, the background behind the person is replaced with config.BackgroundColor,
+// feathering the edge with a blur of config.BackgroundFeather * the face width.
+// If config.Denoise or config.Sharpen are set, the brightened image is also denoised and sharpened.
+// If config.Style is set, the style is applied after brightening.
+// If config.Mask is set, the area outside of the mask is made transparent.
+// If config is nil, DefaultPortraitConfig is used
+func (d *Detector) Portrait(img *image.NRGBA, config *PortraitConfig) (*image.NRGBA, error) {
+	f, err := d.Frame(img, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Render(config), nil
 }
 
 // PortraitFile detects a single face in the image at inpath, rotates, crops, and brightens it, and writes the result to outpath.
+// outpath's extension is changed to match the output format, as returned by config.OutputPath.
 // If config is nil, DefaultPortraitConfig is used
 func (d *Detector) PortraitFile(inpath, outpath string, config *PortraitConfig) error {
+	if config == nil {
+		config = DefaultPortraitConfig
+	}
+
 	img, err := pigo.GetImage(inpath)
 	if err != nil {
 		return fmt.Errorf("could not open image %s: %w", inpath, err)
@@ -65,7 +295,7 @@ func (d *Detector) PortraitFile(inpath, outpath string, config *PortraitConfig)
 		return fmt.Errorf("could not convert image: %w", err)
 	}
 
-	if err = imaging.Save(img, outpath); err != nil {
+	if _, err = config.Save(img, outpath); err != nil {
 		return fmt.Errorf("could not write portrait: %w", err)
 	}
 
@@ -74,8 +304,13 @@ func (d *Detector) PortraitFile(inpath, outpath string, config *PortraitConfig)
 
 // PortraitFileWithEXIF reads EXIF data from the image at inpath, rotating it if necessary,
 // detects a single face in the image, rotates, crops, and brightens it, and writes the result to outpath.
+// outpath's extension is changed to match the output format, as returned by config.OutputPath.
 // If config is nil, DefaultPortraitConfig is used
 func (d *Detector) PortraitFileWithEXIF(inpath, outpath string, config *PortraitConfig) error {
+	if config == nil {
+		config = DefaultPortraitConfig
+	}
+
 	img, err := DecodeFileWithEXIF(inpath)
 	if err != nil {
 		if img == nil {
@@ -88,7 +323,7 @@ func (d *Detector) PortraitFileWithEXIF(inpath, outpath string, config *Portrait
 		return fmt.Errorf("could not convert image: %w", err)
 	}
 
-	if err = imaging.Save(img, outpath); err != nil {
+	if _, err = config.Save(img, outpath); err != nil {
 		return fmt.Errorf("could not write portrait: %w", err)
 	}
 
@@ -0,0 +1,84 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// near returns true if a and b are within tolerance pixels in each coordinate
+func near(a, b image.Point, tolerance int) bool {
+	return absInt(a.X-b.X) <= tolerance && absInt(a.Y-b.Y) <= tolerance
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestUntransform(t *testing.T) {
+	img := imaging.New(300, 200, color.NRGBA{0x80, 0x80, 0x80, 0xff})
+	left, right := image.Pt(120, 90), image.Pt(170, 100)
+	face, err := NewFace(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := FrameFace(img, face, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		angle, scale float64
+		copied       *image.NRGBA
+	}{
+		{"rotated 90", 90, 1, imaging.Rotate(img, 90, color.NRGBA{})},
+		{"rotated -20", -20, 1, imaging.Rotate(img, -20, color.NRGBA{})},
+		{"upscaled", 0, 2, imaging.Resize(img, 600, 400, imaging.Lanczos)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// frame the copy with the face moved into it, like detecting it there
+			move := func(p image.Point) image.Point {
+				return transformPoint(p, test.angle, test.scale, img.Bounds(), test.copied.Bounds())
+			}
+			center, radius := move(image.Pt(face.Bounds.Col, face.Bounds.Row)), int(float64(face.Bounds.Scale)*test.scale)/2
+			bounds := image.Rect(center.X-radius, center.Y-radius, center.X+radius, center.Y+radius)
+			copiedFace, err := NewFaceWithBounds(bounds, move(left), move(right))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := FrameFace(test.copied, copiedFace, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			u := f.Untransform(img.Bounds(), test.copied.Bounds(), test.angle, test.scale)
+			if len(u.Faces) != 1 || !near(image.Pt(u.Faces[0].Col, u.Faces[0].Row), image.Pt(face.Bounds.Col, face.Bounds.Row), 2) {
+				t.Errorf("faces = %+v, want [%+v]", u.Faces, face.Bounds)
+			}
+			if got := image.Pt(u.Face.LeftEye.Col, u.Face.LeftEye.Row); !near(got, left, 1) {
+				t.Errorf("left eye = %v, want %v", got, left)
+			}
+			if got := image.Pt(u.Face.RightEye.Col, u.Face.RightEye.Row); !near(got, right, 1) {
+				t.Errorf("right eye = %v, want %v", got, right)
+			}
+			if math.Abs(u.Angle-want.Angle) > 1 {
+				t.Errorf("angle = %v, want %v", u.Angle, want.Angle)
+			}
+			if !near(u.Crop.Min, want.Crop.Min, 3) || !near(u.Crop.Max, want.Crop.Max, 3) {
+				t.Errorf("crop = %v, want %v", u.Crop, want.Crop)
+			}
+			if u.Rotated != nil || u.RotatedFace != nil {
+				t.Error("untransformed framing has a rotated image")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// Style is the color style applied to a portrait
+type Style string
+
+const (
+	StyleNone      Style = ""
+	StyleGrayscale Style = "grayscale"
+	StyleSepia     Style = "sepia"
+	StyleDuotone   Style = "duotone"
+)
+
+// DefaultGrayscaleWeights are the ITU-R BT.601 luma weights for the red, green, and blue channels
+var DefaultGrayscaleWeights = [3]float64{0.299, 0.587, 0.114}
+
+// normalizeWeights scales weights so they sum to 1, returning DefaultGrayscaleWeights if they sum to 0 or less
+func normalizeWeights(weights [3]float64) [3]float64 {
+	sum := weights[0] + weights[1] + weights[2]
+	if sum <= 0 {
+		return DefaultGrayscaleWeights
+	}
+	return [3]float64{weights[0] / sum, weights[1] / sum, weights[2] / sum}
+}
+
+func luminance(c color.NRGBA, weights [3]float64) float64 {
+	return weights[0]*float64(c.R) + weights[1]*float64(c.G) + weights[2]*float64(c.B)
+}
+
+// GrayscaleWeighted converts the image to grayscale using the given red, green, and blue channel weights.
+// The weights are normalized to sum to 1
+func GrayscaleWeighted(img image.Image, weights [3]float64) *image.NRGBA {
+	weights = normalizeWeights(weights)
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		y := clampUint8(luminance(c, weights))
+		return color.NRGBA{y, y, y, c.A}
+	})
+}
+
+// Sepia tones the image with warm brown tones
+func Sepia(img image.Image) *image.NRGBA {
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return color.NRGBA{
+			clampUint8(0.393*r + 0.769*g + 0.189*b),
+			clampUint8(0.349*r + 0.686*g + 0.168*b),
+			clampUint8(0.272*r + 0.534*g + 0.131*b),
+			c.A,
+		}
+	})
+}
+
+// Duotone maps the luminance of the image, computed with weights, to a gradient from shadow to highlight
+func Duotone(img image.Image, shadow, highlight color.NRGBA, weights [3]float64) *image.NRGBA {
+	weights = normalizeWeights(weights)
+	lerp := func(a, b uint8, t float64) uint8 {
+		return clampUint8(float64(a) + (float64(b)-float64(a))*t)
+	}
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		t := luminance(c, weights) / 255
+		return color.NRGBA{
+			lerp(shadow.R, highlight.R, t),
+			lerp(shadow.G, highlight.G, t),
+			lerp(shadow.B, highlight.B, t),
+			c.A,
+		}
+	})
+}
+
+// ApplyStyle applies style to the image. weights, shadow, and highlight are used as described in GrayscaleWeighted and Duotone
+func ApplyStyle(img image.Image, style Style, weights [3]float64, shadow, highlight color.NRGBA) *image.NRGBA {
+	switch style {
+	case StyleGrayscale:
+		return GrayscaleWeighted(img, weights)
+	case StyleSepia:
+		return Sepia(img)
+	case StyleDuotone:
+		return Duotone(img, shadow, highlight, weights)
+	}
+	return imaging.Clone(img)
+}
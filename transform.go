@@ -6,6 +6,7 @@ import (
 	"math"
 
 	"github.com/disintegration/imaging"
+	pigo "github.com/esimov/pigo/core"
 )
 
 // radToDegree converts radians to degrees
@@ -13,14 +14,83 @@ func radToDegree(rad float64) float64 {
 	return (rad * 180) / math.Pi
 }
 
-// Rotate rotates the image so that the line going through the pupils is parallel with the top edge of the image
-func Rotate(img image.Image, face *Face) *image.NRGBA {
-	angle := radToDegree(math.Atan2(
+// RotationAngle returns the counter-clockwise angle in degrees that Rotate rotates an image containing face
+func RotationAngle(face *Face) float64 {
+	return radToDegree(math.Atan2(
 		-float64(face.LeftEye.Row-face.RightEye.Row),
 		-float64(face.LeftEye.Col-face.RightEye.Col),
 	))
+}
+
+// Rotate rotates the image so that the line going through the pupils is parallel with the top edge of the image
+func Rotate(img image.Image, face *Face) *image.NRGBA {
+	return imaging.Rotate(img, RotationAngle(face), color.NRGBA{})
+}
+
+// rotatePoint returns the position of p after an image with bounds src is rotated angle degrees counter-clockwise
+// by imaging.Rotate into an image with bounds dst
+func rotatePoint(p image.Point, angle float64, src, dst image.Rectangle) image.Point {
+	return transformPoint(p, angle, 1, src, dst)
+}
+
+// transformPoint returns the position of p after an image with bounds src is rotated angle degrees counter-clockwise
+// by imaging.Rotate and scaled by scale around its center into an image with bounds dst
+func transformPoint(p image.Point, angle, scale float64, src, dst image.Rectangle) image.Point {
+	sin, cos := math.Sincos(math.Pi * angle / 180)
+	x := float64(p.X) - (float64(src.Dx())/2 - 0.5)
+	y := float64(p.Y) - (float64(src.Dy())/2 - 0.5)
+	return image.Pt(
+		int(math.Round((x*cos+y*sin)*scale+float64(dst.Dx())/2-0.5)),
+		int(math.Round((-x*sin+y*cos)*scale+float64(dst.Dy())/2-0.5)),
+	)
+}
+
+// transformFace returns face moved to its position after an image with bounds src is rotated angle degrees counter-clockwise
+// and scaled by scale into an image with bounds dst. Undetected pupils are left as they are
+func transformFace(face *Face, angle, scale float64, src, dst image.Rectangle) *Face {
+	transformed := &Face{Bounds: face.Bounds, LeftEye: face.LeftEye, RightEye: face.RightEye}
+	c := transformPoint(image.Pt(face.Bounds.Col, face.Bounds.Row), angle, scale, src, dst)
+	transformed.Bounds.Col, transformed.Bounds.Row = c.X, c.Y
+	transformed.Bounds.Scale = int(math.Round(float64(face.Bounds.Scale) * scale))
 
-	return imaging.Rotate(img, angle, color.NRGBA{})
+	for _, eye := range []**pigo.Puploc{&transformed.LeftEye, &transformed.RightEye} {
+		if *eye == nil || (*eye).Row <= 0 || (*eye).Col <= 0 {
+			continue
+		}
+		p := **eye
+		c := transformPoint(image.Pt(p.Col, p.Row), angle, scale, src, dst)
+		p.Col, p.Row = c.X, c.Y
+		p.Scale *= float32(scale)
+		*eye = &p
+	}
+
+	return transformed
+}
+
+// RotatedBounds returns the bounds of the image imaging.Rotate returns when rotating an image with bounds b
+// angle degrees counter-clockwise
+func RotatedBounds(b image.Rectangle, angle float64) image.Rectangle {
+	w, h := b.Dx(), b.Dy()
+	switch angle - math.Floor(angle/360)*360 {
+	case 0, 180:
+		return image.Rect(0, 0, w, h)
+	case 90, 270:
+		return image.Rect(0, 0, h, w)
+	}
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}
+	}
+
+	// the size of the rotated corners, rounded up like imaging.Rotate
+	sin, cos := math.Sincos(math.Pi * angle / 180)
+	size := func(a, b float64) int {
+		s := math.Abs(a) + math.Abs(b) + 1
+		if s-math.Floor(s) > 0.1 {
+			s++
+		}
+		return int(s)
+	}
+	return image.Rect(0, 0, size(float64(w-1)*cos, float64(h-1)*sin), size(float64(w-1)*sin, float64(h-1)*cos))
 }
 
 // checkCorners returns true if all four corners of the rectangle specified by center x, y and width and height
@@ -42,31 +112,29 @@ func checkCorners(img image.Image, x, y, width, height int) bool {
 	return true
 }
 
-func crop(img image.Image, x, y, width, height int) *image.NRGBA {
-	rect := image.Rect(x-(width/2), y-(height/2), x+(width/2), y+(height/2))
-	return imaging.Crop(img, rect)
+func cropRect(x, y, width, height int) image.Rectangle {
+	return image.Rect(x-(width/2), y-(height/2), x+(width/2), y+(height/2))
 }
 
-// Crop crops the image to the largest bounding box that doesn't contain transparent pixels.
-// aspectRatio is the ratio width / height.
-// maxWidthRatio is the maximum width of the cropped image / the width of the detected face
-func Crop(img image.Image, face *Face, aspectRatio, maxWidthRatio float64) *image.NRGBA {
+// cropRectCentered returns the largest bounding box around the face that doesn't contain transparent pixels,
+// with its vertical center given by centerY for each candidate height
+func cropRectCentered(img image.Image, face *Face, aspectRatio, maxWidthRatio float64, centerY func(height int) int) image.Rectangle {
 	aspect := float64(1.0 / aspectRatio)
 	minWidth := face.Bounds.Scale
 	maxWidth := int(float64(minWidth) * maxWidthRatio)
 	maxHeight := int(float64(maxWidth) * aspect)
 	x := (face.LeftEye.Col + face.RightEye.Col) / 2
-	y := (face.LeftEye.Row+face.RightEye.Row)/2 + int(float64(maxHeight)*0.1)
 
-	if checkCorners(img, x, y, maxWidth, maxHeight) {
-		return crop(img, x, y, maxWidth, maxHeight)
+	if y := centerY(maxHeight); checkCorners(img, x, y, maxWidth, maxHeight) {
+		return cropRect(x, y, maxWidth, maxHeight)
 	}
 	for {
 		width := (maxWidth + minWidth) / 2
 		height := int(float64(width) * aspect)
+		y := centerY(height)
 
 		if width == minWidth {
-			return crop(img, x, y, width, height)
+			return cropRect(x, y, width, height)
 		}
 
 		if checkCorners(img, x, y, width, height) {
@@ -77,6 +145,53 @@ func Crop(img image.Image, face *Face, aspectRatio, maxWidthRatio float64) *imag
 	}
 }
 
+// CropRect returns the largest bounding box around the face that doesn't contain transparent pixels.
+// aspectRatio is the ratio width / height.
+// maxWidthRatio is the maximum width of the cropped image / the width of the detected face
+func CropRect(img image.Image, face *Face, aspectRatio, maxWidthRatio float64) image.Rectangle {
+	aspect := float64(1.0 / aspectRatio)
+	maxHeight := int(float64(int(float64(face.Bounds.Scale)*maxWidthRatio)) * aspect)
+	y := (face.LeftEye.Row+face.RightEye.Row)/2 + int(float64(maxHeight)*0.1)
+	return cropRectCentered(img, face, aspectRatio, maxWidthRatio, func(int) int { return y })
+}
+
+// CropRectHeadroom returns the largest bounding box around the face that doesn't contain transparent pixels,
+// positioned so the top of the head at row crown (e.g. from EstimateCrown) is headroom * the box height below the top of the box.
+// aspectRatio is the ratio width / height.
+// maxWidthRatio is the maximum width of the cropped image / the width of the detected face
+func CropRectHeadroom(img image.Image, face *Face, crown int, aspectRatio, maxWidthRatio, headroom float64) image.Rectangle {
+	return cropRectCentered(img, face, aspectRatio, maxWidthRatio, func(height int) int {
+		return crown - int(headroom*float64(height)) + height/2
+	})
+}
+
+// Crop crops the image to the largest bounding box that doesn't contain transparent pixels.
+// aspectRatio is the ratio width / height.
+// maxWidthRatio is the maximum width of the cropped image / the width of the detected face
+func Crop(img image.Image, face *Face, aspectRatio, maxWidthRatio float64) *image.NRGBA {
+	return imaging.Crop(img, CropRect(img, face, aspectRatio, maxWidthRatio))
+}
+
+// Translate returns a copy of face moved by offset
+func (f *Face) Translate(offset image.Point) *Face {
+	face := &Face{Bounds: f.Bounds}
+	face.Bounds.Row += offset.Y
+	face.Bounds.Col += offset.X
+	if f.LeftEye != nil {
+		eye := *f.LeftEye
+		eye.Row += offset.Y
+		eye.Col += offset.X
+		face.LeftEye = &eye
+	}
+	if f.RightEye != nil {
+		eye := *f.RightEye
+		eye.Row += offset.Y
+		eye.Col += offset.X
+		face.RightEye = &eye
+	}
+	return face
+}
+
 // Brighten brightens the image for better detail in the face
 func Brighten(img image.Image, brightness, contrast, gamma float64) *image.NRGBA {
 	i := imaging.AdjustBrightness(img, brightness)
@@ -0,0 +1,21 @@
+package facedetect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestRotatedBounds(t *testing.T) {
+	for _, size := range []image.Point{{100, 50}, {37, 81}, {1, 1}, {640, 480}} {
+		img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+		for _, angle := range []float64{0, 90, 180, 270, -90, 20, -20, 40, -40, 135, 1.5, 450} {
+			want := imaging.Rotate(img, angle, color.NRGBA{}).Bounds()
+			if got := RotatedBounds(img.Bounds(), angle); got != want {
+				t.Errorf("RotatedBounds(%v, %v) = %v, want %v", img.Bounds(), angle, got, want)
+			}
+		}
+	}
+}
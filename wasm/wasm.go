@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"syscall/js"
@@ -12,52 +14,128 @@ import (
 	"github.com/korylprince/go-face-detect/cascade"
 )
 
-func convert(buf []byte) ([]byte, error) {
+// decode decodes the image in buf, applying its EXIF orientation
+func decode(buf []byte) (*image.NRGBA, error) {
 	img, err := facedetect.DecodeWithEXIF(bytes.NewReader(buf))
 	if err != nil {
 		if img == nil {
 			return nil, fmt.Errorf("could not decode image: %w", err)
 		}
 	}
+	return img, nil
+}
+
+// encode encodes img as a PNG
+func encode(img *image.NRGBA) ([]byte, error) {
+	out := new(bytes.Buffer)
+	if err := imaging.Encode(out, img, imaging.PNG); err != nil {
+		return nil, fmt.Errorf("could not encode to png: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+func convert(buf []byte) ([]byte, error) {
+	img, err := decode(buf)
+	if err != nil {
+		return nil, err
+	}
 
 	img, err = cascade.Detector.Portrait(img, facedetect.DefaultPortraitConfig)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert to portrait: %w", err)
 	}
 
-	out := new(bytes.Buffer)
-	if err = imaging.Encode(out, img, imaging.PNG); err != nil {
-		return nil, fmt.Errorf("could not encode to png: %w", err)
+	return encode(img)
+}
+
+// convertFromEyes converts the image in buf to a portrait with the pupils at the given points, without detection
+func convertFromEyes(buf []byte, leftEye, rightEye image.Point) ([]byte, error) {
+	img, err := decode(buf)
+	if err != nil {
+		return nil, err
 	}
 
-	return out.Bytes(), nil
+	face, err := facedetect.NewFace(leftEye, rightEye)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err = facedetect.PortraitFromFace(img, face, facedetect.DefaultPortraitConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert to portrait: %w", err)
+	}
+
+	return encode(img)
+}
+
+// promise returns a promise that resolves the Uint8Array returned by fn, or rejects with its error
+func promise(fn func() ([]byte, error)) js.Value {
+	handler := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		resolve := args[0]
+		reject := args[1]
+
+		go func() {
+			converted, err := fn()
+			if err != nil {
+				errorObject := js.Global().Get("Error").New(err.Error())
+				reject.Invoke(errorObject)
+				return
+			}
+			convertedArray := js.Global().Get("Uint8Array").New(len(converted))
+			js.CopyBytesToJS(convertedArray, converted)
+			resolve.Invoke(convertedArray)
+		}()
+
+		return nil
+	})
+
+	return js.Global().Get("Promise").New(handler)
+}
+
+// reject returns a promise that rejects with err
+func reject(err error) js.Value {
+	return promise(func() ([]byte, error) {
+		return nil, err
+	})
+}
+
+// isBuffer returns true if v is a Uint8Array
+func isBuffer(v js.Value) bool {
+	return v.InstanceOf(js.Global().Get("Uint8Array"))
 }
 
 func main() {
 	// convertPortrait(buffer Uint8Array) returns a promise that resolves the resulting Uint8Array
 	js.Global().Set("convertPortrait", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) < 1 || !isBuffer(args[0]) {
+			return reject(errors.New("expected a Uint8Array"))
+		}
 		buf := make([]byte, args[0].Length())
 		js.CopyBytesToGo(buf, args[0])
-		handler := js.FuncOf(func(_ js.Value, args []js.Value) any {
-			resolve := args[0]
-			reject := args[1]
-
-			go func() {
-				converted, err := convert(buf)
-				if err != nil {
-					errorObject := js.Global().Get("Error").New(err.Error())
-					reject.Invoke(errorObject)
-					return
-				}
-				convertedArray := js.Global().Get("Uint8Array").New(len(converted))
-				js.CopyBytesToJS(convertedArray, converted)
-				resolve.Invoke(convertedArray)
-			}()
-
-			return nil
+		return promise(func() ([]byte, error) {
+			return convert(buf)
 		})
+	}))
 
-		return js.Global().Get("Promise").New(handler)
+	// convertPortraitFromEyes(buffer Uint8Array, leftX, leftY, rightX, rightY Number) returns a promise that resolves
+	// the resulting Uint8Array, using the given pupil coordinates (in pixels of the EXIF oriented image) instead of detection
+	js.Global().Set("convertPortraitFromEyes", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) < 5 || !isBuffer(args[0]) {
+			return reject(errors.New("expected a Uint8Array and four eye coordinates"))
+		}
+		for _, arg := range args[1:5] {
+			if arg.Type() != js.TypeNumber {
+				return reject(fmt.Errorf("eye coordinates must be numbers, got %s", arg.Type()))
+			}
+		}
+		buf := make([]byte, args[0].Length())
+		js.CopyBytesToGo(buf, args[0])
+		leftEye := image.Pt(args[1].Int(), args[2].Int())
+		rightEye := image.Pt(args[3].Int(), args[4].Int())
+		return promise(func() ([]byte, error) {
+			return convertFromEyes(buf, leftEye, rightEye)
+		})
 	}))
 
 	// wait forever so wasm function continues to execute